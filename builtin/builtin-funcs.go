@@ -2,33 +2,129 @@ package builtin
 
 import (
 	"fmt"
+	"strings"
 
 	. "github.com/bigyihsuan/structlang/value"
 )
 
-var builtinFuncs = map[string]func(vs ...Value) Value{
-	"print":   print_,
-	"println": println_,
+// BuiltinFunc is a function that every program can call by name.
+type BuiltinFunc struct {
+	// Types are the types that the function can be called with, tried in order.
+	// There are none if it takes any number of values of any type.
+	Types []TypeName
+	call  func(args []Value) (Value, error)
 }
 
-func BuiltinFuncs() map[string]func(...Value) Value { return builtinFuncs }
+// IsVariadic reports whether b takes any number of values of any type, like `print`.
+func (b BuiltinFunc) IsVariadic() bool {
+	return len(b.Types) == 0
+}
+
+// Call checks args against the types of b, and calls b with them.
+func (b BuiltinFunc) Call(args ...Value) (Value, error) {
+	if b.IsVariadic() {
+		return b.call(args)
+	}
+	var checked []Value
+	var err error
+	for _, ty := range b.Types {
+		params, _, _ := ty.FuncParts()
+		if checked, err = checkArgs(params, args); err == nil {
+			break
+		}
+	}
+	if err != nil && len(b.Types) > 1 {
+		got := []TypeName{}
+		for _, arg := range args {
+			got = append(got, arg.TypeName())
+		}
+		return nil, fmt.Errorf("incorrect argument types for func: got `%s`, want %s", Signature(got), b.Signatures())
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, arg := range checked {
+		// a parameter that can be one of several types only needs the value it holds
+		if held, isEither := arg.(Either); isEither {
+			checked[i] = held.Held
+		}
+	}
+	return b.call(checked)
+}
+
+// Signatures lists the parameters of every type of b, like "`(int)` or `(float)`".
+func (b BuiltinFunc) Signatures() string {
+	sigs := []string{}
+	for _, ty := range b.Types {
+		params, _, _ := ty.FuncParts()
+		sigs = append(sigs, "`"+Signature(params)+"`")
+	}
+	return strings.Join(sigs, " or ")
+}
+
+// Signature writes a list of parameter or argument types, like `(int, float)`.
+func Signature(types []TypeName) string {
+	names := []string{}
+	for _, ty := range types {
+		names = append(names, ty.String())
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// checkArgs checks and coerces the arguments of a builtin function or method,
+// like Func.Call checks the arguments of functions written in the language.
+func checkArgs(params []TypeName, args []Value) ([]Value, error) {
+	if len(args) != len(params) {
+		return nil, fmt.Errorf("incorrect numbers of arguments for func: got %d, want %d", len(args), len(params))
+	}
+	coerced := []Value{}
+	for i, arg := range args {
+		v, ok := Coerce(arg, params[i])
+		if !ok {
+			return nil, fmt.Errorf("incorrect argument types for func: got %s, want %s", arg.TypeName(), params[i])
+		}
+		coerced = append(coerced, v)
+	}
+	return coerced, nil
+}
+
+var builtinFuncs = map[string]BuiltinFunc{
+	"print":   {call: print_},
+	"println": {call: println_},
+}
+
+func init() {
+	for _, funcs := range []map[string]BuiltinFunc{stringFuncs, mathFuncs} {
+		for name, f := range funcs {
+			builtinFuncs[name] = f
+		}
+	}
+}
+
+func BuiltinFuncs() map[string]BuiltinFunc { return builtinFuncs }
+
+// IsBuiltinFunc reports whether name is a builtin function, which can't be redefined.
+func IsBuiltinFunc(name string) bool {
+	_, ok := builtinFuncs[name]
+	return ok
+}
 
-func print_(vs ...Value) Value {
+func print_(vs []Value) (Value, error) {
 	if len(vs) == 0 {
 		fmt.Print()
 	}
 	for _, v := range vs {
 		fmt.Print(v.PrintString())
 	}
-	return NewNil()
+	return NewNil(), nil
 }
 
-func println_(vs ...Value) Value {
+func println_(vs []Value) (Value, error) {
 	if len(vs) == 0 {
 		fmt.Println()
 	}
 	for _, v := range vs {
 		fmt.Println(v.PrintString())
 	}
-	return NewNil()
+	return NewNil(), nil
 }
@@ -0,0 +1,81 @@
+package builtin
+
+import (
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Either holds a value of exactly one of the alternatives of an `either[T,U]`.
+// The held value can only be reached through `match`.
+type Either struct {
+	Type     TypeName // the full `either[T,U]` type, not the type of the held value
+	Held     Value
+	IsReturn bool
+}
+
+func NewEither(ty TypeName, held Value) Either {
+	return Either{Type: ty, Held: held}
+}
+
+func (e Either) Get(field string) Value {
+	switch field {
+	case "v":
+		return e
+	case "name":
+		return NewString(e.Type.String())
+	case "len":
+		return NewInt(0)
+	default:
+		return nil
+	}
+}
+func (e Either) TypeName() TypeName {
+	return e.Type
+}
+func (e Either) Unwrap() any {
+	return e.Held.Unwrap()
+}
+func (e Either) PrintString() string {
+	return e.Held.PrintString()
+}
+func (e Either) Copy() Value {
+	e.Held = Copy(e.Held)
+	return e
+}
+func (e Either) Return(isReturn bool) Value {
+	e.IsReturn = isReturn
+	return e
+}
+
+// Coerce checks that val can be stored where a value of type want is expected.
+// Storing an alternative of an either type wraps it in an Either.
+func Coerce(val Value, want TypeName) (Value, bool) {
+	got := val.TypeName()
+	if got.Equal(want) {
+		return val, true
+	}
+	if !want.IsEither() {
+		return val, false
+	}
+	if held, isEither := val.(Either); isEither {
+		// re-wrap the held value of a different either type
+		return Coerce(held.Held, want)
+	}
+	for _, alt := range want.Vars {
+		if v, ok := Coerce(val, alt); ok {
+			return NewEither(want, v), true
+		}
+	}
+	return val, false
+}
+
+// Narrow unwraps val from any Either until it is of type ty.
+// It reports false if val doesn't hold a ty.
+func Narrow(val Value, ty TypeName) (Value, bool) {
+	if val.TypeName().Equal(ty) {
+		return val, true
+	}
+	if held, isEither := val.(Either); isEither {
+		return Narrow(held.Held, ty)
+	}
+	return val, false
+}
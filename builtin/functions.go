@@ -10,22 +10,81 @@ import (
 	. "github.com/bigyihsuan/structlang/value"
 )
 
+// MaxCallDepth is how many function calls can be running at once. A call beyond it is a runtime error,
+// so runaway recursion stops its statement like any other error instead of the whole program.
+const MaxCallDepth = 10000
+
+// ErrCallDepth is the error of a call beyond MaxCallDepth.
+var ErrCallDepth = fmt.Errorf("call depth limit of %d exceeded", MaxCallDepth)
+
 type Func struct { // function name
-	Args     []util.Pair[string, TypeName] // function arguments; oredered map of variable names to their types
-	Body     []ast.Stmt                    // the actual code of the function
-	Env      *env.Env                      // the env the parameter variables live in
-	IsReturn bool
+	TypeParams []string                      // the type parameters of a generic function
+	TypeArgs   []TypeName                    // the types filling in TypeParams, once the function is instantiated
+	Args       []util.Pair[string, TypeName] // function arguments; oredered map of variable names to their types
+	Ret        TypeName                      // the return type, `nil` if the function doesn't declare one
+	Body       []ast.Stmt                    // the actual code of the function
+	Env        *env.Env                      // the env the function was defined in, which every call's env is a child of
+	IsReturn   bool
 }
 
 func (f Func) Get(field string) Value {
-	return NewNil()
+	// functions have no fields
+	return nil
 }
 func (f Func) TypeName() TypeName {
-	args := make([]string, len(f.Args))
+	params := []TypeName{}
 	for _, a := range f.Args {
-		args = append(args, a.Last.String())
+		params = append(params, a.Last)
+	}
+	ty := FuncType(params, f.Ret)
+	if f.IsGeneric() {
+		ty.Params = f.TypeParams
+	}
+	return ty
+}
+
+// IsGeneric reports whether f has type parameters that haven't been filled in yet.
+func (f Func) IsGeneric() bool {
+	return len(f.TypeParams) > 0 && f.TypeArgs == nil
+}
+
+// Instantiate fills in the type parameters of a generic function.
+func (f Func) Instantiate(typeArgs []TypeName) (Func, error) {
+	if !f.IsGeneric() {
+		return f, fmt.Errorf("cannot give type parameters to non-generic `%s`", f.TypeName())
+	}
+	instance, err := f.TypeName().Instantiate(typeArgs)
+	if err != nil {
+		return f, err
+	}
+	params, ret, _ := instance.FuncParts()
+	f.Args = append([]util.Pair[string, TypeName]{}, f.Args...)
+	for i := range f.Args {
+		f.Args[i].Last = params[i]
+	}
+	f.Ret = ret
+	f.TypeArgs = typeArgs
+	return f, nil
+}
+
+// Infer finds the type arguments of a generic function from the values it is called with.
+func (f Func) Infer(args []Value) ([]TypeName, error) {
+	argTypes := []TypeName{}
+	for _, arg := range args {
+		argTypes = append(argTypes, arg.TypeName())
+	}
+	return f.TypeName().Infer(argTypes)
+}
+
+// DefineTypeArgs defines the type parameters of an instantiated function in define,
+// as aliases of the types filling them in, so that the body can use them like any other type.
+func (f Func) DefineTypeArgs(define func(name string, ty Type)) {
+	for i, param := range f.TypeParams {
+		if i < len(f.TypeArgs) {
+			typeArg := f.TypeArgs[i]
+			define(param, Type{Fields: map[string]TypeName{}, Vars: []TypeName{}, Alias: &typeArg})
+		}
 	}
-	return TypeName{Name: fmt.Sprintf("func(%s)", strings.Join(args, ", "))}
 }
 func (f Func) Unwrap() any {
 	return NewNil()
@@ -37,28 +96,67 @@ func (f Func) PrintString() string {
 		ty := p.Last
 		args = append(args, fmt.Sprintf("%s %s", name, ty))
 	}
-	return fmt.Sprintf("func(%s)", strings.Join(args, ", "))
+	generic := ""
+	if f.IsGeneric() {
+		generic = fmt.Sprintf("[%s]", strings.Join(f.TypeParams, ", "))
+	}
+	if f.Ret.Name == "nil" {
+		return fmt.Sprintf("func%s(%s)", generic, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("func%s(%s) %s", generic, strings.Join(args, ", "), f.Ret)
 }
 func (f Func) Return(isReturn bool) Value {
 	f.IsReturn = isReturn
 	return f
 }
 
+// Call runs the function body in a fresh env for this call, so that the arguments of
+// recursive calls don't clobber each other. Its parent is the env the function was defined in,
+// so the body sees the variables it captured as they are now, including any later `set`.
 func (f Func) Call(evaluator Eval, args ...Value) (Value, error) {
 	if len(args) != len(f.Args) {
-		// TODO: better runtime error handling
-		panic(fmt.Sprintf("incorrect numbers of arguments for func: got %d, want %d", len(args), len(f.Args)))
+		return nil, fmt.Errorf("incorrect numbers of arguments for func: got %d, want %d", len(args), len(f.Args))
+	}
+	if f.IsGeneric() {
+		typeArgs, err := f.Infer(args)
+		if err != nil {
+			return nil, err
+		}
+		if f, err = f.Instantiate(typeArgs); err != nil {
+			return nil, err
+		}
 	}
+	callEnv := f.Env.MakeChild()
+	f.DefineTypeArgs(callEnv.DefineType)
 	for i, argValue := range args {
 		argName := f.Args[i].First
 		argType := f.Args[i].Last
-		if argValue.TypeName().Name != argType.Name {
-			panic(fmt.Sprintf("incorrect argument types for func: got %s, want %s", argValue.TypeName(), argType))
+		coerced, ok := Coerce(argValue, argType)
+		if !ok {
+			return nil, fmt.Errorf("incorrect argument types for func: got %s, want %s", argValue.TypeName(), argType)
 		}
-		f.Env.DefineVariable(argName, argValue)
+		callEnv.DefineVariable(argName, coerced)
 	}
 
-	// TODO: return values
-	retVal, err := evaluator.Evaluate(f.Env, f.Body)
-	return retVal, err
+	retVal, err := evaluator.Evaluate(&callEnv, f.Body)
+	if err != nil {
+		return nil, err
+	}
+	if retVal == nil {
+		return CheckReturn(NewNil(), f.Ret, true)
+	}
+	return CheckReturn(retVal, f.Ret, false)
+}
+
+// CheckReturn checks that a function returning ret can return v, and coerces it to ret.
+// fellOff is whether the body ended without a `return`, which returns nil.
+func CheckReturn(v Value, ret TypeName, fellOff bool) (Value, error) {
+	coerced, ok := Coerce(v, ret)
+	if ok {
+		return coerced, nil
+	}
+	if fellOff {
+		return nil, fmt.Errorf("missing return in function returning `%s`", ret)
+	}
+	return nil, fmt.Errorf("mismatched return type: want `%s`, got `%s`", ret, v.TypeName())
 }
@@ -0,0 +1,130 @@
+package builtin
+
+import (
+	"fmt"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Iterator goes through the elements of a value for a `for` loop.
+// It is a value only so that it can sit on the stack of the vm while the loop runs.
+type Iterator struct {
+	// next gives the next element and its position, and reports false once there are none left
+	next func() (index, elem Value, ok bool, err error)
+}
+
+// Next gives the next element and its position, which is the key of a map. ok is false once the loop is done.
+func (it Iterator) Next() (index, elem Value, ok bool, err error) {
+	return it.next()
+}
+
+func (it Iterator) Get(field string) Value { return nil }
+func (it Iterator) TypeName() TypeName     { return TypeName{Name: "iterator"} }
+func (it Iterator) Return(bool) Value      { return it }
+func (it Iterator) Unwrap() any            { return it.next }
+func (it Iterator) PrintString() string    { return "iterator" }
+
+// IterMethod is the method a struct needs to be gone through by a `for` loop.
+// It returns a function that gives the next element every time it is called, and nil once there are none left.
+const IterMethod = "iter"
+
+// IterType finds the types of the positions and the elements that Iterate gives for a value of type iterable.
+// iterMethod finds the type of the `iter` method of a struct.
+func IterType(iterable TypeName, withIndex bool, iterMethod func() (TypeName, bool)) (index, elem TypeName, err error) {
+	index = NewInt(0).TypeName()
+	switch {
+	case iterable.Name == "string":
+		return index, iterable, nil
+	case iterable.IsList():
+		return index, iterable.Vars[0], nil
+	case iterable.IsMap() && withIndex:
+		return iterable.Vars[0], iterable.Vars[1], nil
+	case iterable.IsMap():
+		return index, iterable.Vars[0], nil
+	}
+	method, ok := iterMethod()
+	if !ok {
+		return index, elem, fmt.Errorf("cannot iterate over `%s`", iterable)
+	}
+	if params, ret, _ := method.FuncParts(); len(params) == 1 {
+		if nextParams, next, isFunc := ret.FuncParts(); isFunc && len(nextParams) == 0 && next.IsEither() && len(next.Vars) == 2 && next.Vars[1].Name == "nil" {
+			return index, next.Vars[0], nil
+		}
+	}
+	return index, elem, fmt.Errorf("method `%s` of `%s` must have type `func() func() either[T,nil]`, got `%s`", IterMethod, iterable, method)
+}
+
+// Iterate starts going through v, which is a copy so that the loop can change the original.
+// A string gives its runes, a list its elements, and a map its values in the order of their keys,
+// or its keys if withIndex is false, since a loop with one name over a map names the keys.
+// A struct is gone through with its `iter` method, found with lookup and run with call,
+// which also runs the function it returns.
+func Iterate(v Value, withIndex bool, lookup func(name string) *Type, call func(fn Value, args []Value) (Value, error)) (Iterator, error) {
+	switch v := Copy(v).(type) {
+	case StringValue:
+		runes := []rune(v.Unwrap().(string))
+		return positions(len(runes), func(i int) Value { return NewString(string(runes[i])) }), nil
+	case List:
+		return positions(len(v.Elems), func(i int) Value { return v.Elems[i] }), nil
+	case Map:
+		keys := v.Keys()
+		i := 0
+		return Iterator{next: func() (Value, Value, bool, error) {
+			if i >= len(keys) {
+				return nil, nil, false, nil
+			}
+			key := keys[i]
+			i++
+			if !withIndex {
+				return NewInt(i - 1), key, true, nil
+			}
+			return key, v.entries[key.Unwrap()].val, true, nil
+		}}, nil
+	}
+	method, ok := MethodOf(v, IterMethod, lookup)
+	if !ok {
+		return Iterator{}, fmt.Errorf("cannot iterate over `%s`", v.TypeName())
+	}
+	next, err := call(method, []Value{v})
+	if err != nil {
+		return Iterator{}, err
+	}
+	i := 0
+	return Iterator{next: func() (Value, Value, bool, error) {
+		elem, err := call(next, nil)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if held, isEither := elem.(Either); isEither {
+			elem = held.Held
+		}
+		if elem.TypeName().Name == "nil" {
+			return nil, nil, false, nil
+		}
+		i++
+		return NewInt(i - 1), elem, true, nil
+	}}, nil
+}
+
+// Range goes through the ints from lo up to but not including hi.
+func Range(lo, hi Value) (Iterator, error) {
+	start, isInt := lo.(IntValue)
+	end, isEndInt := hi.(IntValue)
+	if !isInt || !isEndInt {
+		return Iterator{}, fmt.Errorf("range bounds must be `int`, got `%s` and `%s`", lo.TypeName(), hi.TypeName())
+	}
+	from := start.Unwrap().(int)
+	return positions(end.Unwrap().(int)-from, func(i int) Value { return NewInt(from + i) }), nil
+}
+
+// positions goes through n elements that are found by their position.
+func positions(n int, at func(i int) Value) Iterator {
+	i := 0
+	return Iterator{next: func() (Value, Value, bool, error) {
+		if i >= n {
+			return nil, nil, false, nil
+		}
+		i++
+		return NewInt(i - 1), at(i - 1), true, nil
+	}}
+}
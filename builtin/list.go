@@ -0,0 +1,142 @@
+package builtin
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// List is a value of the builtin `list[T]`: its elements in order, which are all of type Elem.
+// Like structs, lists are values, so every variable and field holds its own copy.
+type List struct {
+	Elem     TypeName
+	Elems    []Value
+	IsReturn bool
+}
+
+// NewList builds a list of elems, which must all be storable as elem.
+func NewList(elem TypeName, elems []Value) (List, error) {
+	l := List{Elem: elem, Elems: []Value{}}
+	for i, v := range elems {
+		coerced, ok := Coerce(v, elem)
+		if !ok {
+			return l, fmt.Errorf("unexpected type for element %d of `%s`: got `%s`, want `%s`", i, l.TypeName(), v.TypeName(), elem)
+		}
+		l.Elems = append(l.Elems, Copy(coerced))
+	}
+	return l, nil
+}
+
+// Get gets a field of l. Lists have the same fields as the primitives, where `len` is the number of elements.
+func (l List) Get(field string) Value {
+	switch field {
+	case "v":
+		return l
+	case "name":
+		return NewString(l.TypeName().String())
+	case "len":
+		return NewInt(len(l.Elems))
+	default:
+		return nil
+	}
+}
+func (l List) TypeName() TypeName {
+	return ListType(l.Elem)
+}
+func (l List) Unwrap() any {
+	return l.Elems
+}
+func (l List) PrintString() string {
+	elems := []string{}
+	for _, v := range l.Elems {
+		elems = append(elems, v.PrintString())
+	}
+	return fmt.Sprintf("%s{%s}", l.TypeName(), strings.Join(elems, ", "))
+}
+func (l List) Copy() Value {
+	elems := make([]Value, len(l.Elems))
+	for i, v := range l.Elems {
+		elems[i] = Copy(v)
+	}
+	l.Elems = elems
+	return l
+}
+func (l List) Return(isReturn bool) Value {
+	l.IsReturn = isReturn
+	return l
+}
+
+// index checks that index is an int within the bounds of l, which are 0 to len(l.Elems) if end is set.
+func (l List) index(index Value, end bool) (int, error) {
+	i, isInt := index.(IntValue)
+	if !isInt {
+		return 0, fmt.Errorf("index must be `int`, got `%s`", index.TypeName())
+	}
+	n := i.Unwrap().(int)
+	last := len(l.Elems) - 1
+	if end {
+		last++
+	}
+	if n < 0 || n > last {
+		return 0, fmt.Errorf("index %d out of range for `%s` of length %d", n, l.TypeName(), len(l.Elems))
+	}
+	return n, nil
+}
+
+func (l List) at(index Value) (Value, error) {
+	i, err := l.index(index, false)
+	if err != nil {
+		return nil, err
+	}
+	return l.Elems[i], nil
+}
+
+func (l List) setAt(index, val Value) error {
+	i, err := l.index(index, false)
+	if err != nil {
+		return err
+	}
+	coerced, ok := Coerce(val, l.Elem)
+	if !ok {
+		return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", l.Elem, val.TypeName())
+	}
+	l.Elems[i] = Copy(coerced)
+	return nil
+}
+
+// ListMethod finds the type of the builtin method name of lists of elem.
+// Like the type of any method, it takes the list it is called on as its first argument.
+func ListMethod(elem TypeName, name string) (TypeName, bool) {
+	list := ListType(elem)
+	switch name {
+	case "append":
+		// a new list with x after the elements of the list
+		return FuncType([]TypeName{list, elem}, list), true
+	case "slice":
+		// a new list of the elements from lo up to but not including hi
+		return FuncType([]TypeName{list, NewInt(0).TypeName(), NewInt(0).TypeName()}, list), true
+	}
+	return TypeName{}, false
+}
+
+func (l List) call(name string, args []Value) (Value, error) {
+	switch name {
+	case "append":
+		return NewList(l.Elem, append(append([]Value{}, l.Elems...), args[0]))
+	case "slice":
+		lo, err := l.index(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := l.index(args[1], true)
+		if err != nil {
+			return nil, err
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("invalid slice of `%s`: %d is after %d", l.TypeName(), lo, hi)
+		}
+		return NewList(l.Elem, l.Elems[lo:hi])
+	}
+	return nil, fmt.Errorf("method `%s` not found in type `%s`", name, l.TypeName())
+}
@@ -0,0 +1,184 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Map is a value of the builtin `map[K,V]`, which maps keys of type Key to values of type Val.
+// Like structs, maps are values, so every variable and field holds its own copy.
+type Map struct {
+	Key, Val TypeName
+	entries  map[any]mapEntry // by the unwrapped key
+	IsReturn bool
+}
+
+type mapEntry struct {
+	key, val Value
+}
+
+// KeyError reports why values of type key can't be the keys of a map, or nil if they can.
+// Keys are the primitives that implement Cmp, so that the keys of a map can be gone through in order.
+func KeyError(key TypeName) error {
+	switch key.Name {
+	case "int", "float", "string":
+		return nil
+	}
+	return fmt.Errorf("invalid map key type `%s`: keys must be `int`, `float` or `string`", key)
+}
+
+// NewMap builds a map of the keys to the vals at the same positions.
+// A key that is given again replaces the value it was given before.
+func NewMap(key, val TypeName, keys, vals []Value) (Map, error) {
+	m := Map{Key: key, Val: val, entries: make(map[any]mapEntry)}
+	if err := KeyError(key); err != nil {
+		return m, err
+	}
+	for i := range keys {
+		if err := m.insert(keys[i], vals[i]); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// Get gets a field of m. Maps have the same fields as the primitives, where `len` is the number of keys.
+func (m Map) Get(field string) Value {
+	switch field {
+	case "v":
+		return m
+	case "name":
+		return NewString(m.TypeName().String())
+	case "len":
+		return NewInt(len(m.entries))
+	default:
+		return nil
+	}
+}
+func (m Map) TypeName() TypeName {
+	return MapType(m.Key, m.Val)
+}
+func (m Map) Unwrap() any {
+	return m.entries
+}
+func (m Map) PrintString() string {
+	entries := []string{}
+	for _, key := range m.Keys() {
+		entries = append(entries, fmt.Sprintf("%s: %s", key.PrintString(), m.entries[key.Unwrap()].val.PrintString()))
+	}
+	return fmt.Sprintf("%s{%s}", m.TypeName(), strings.Join(entries, ", "))
+}
+func (m Map) Copy() Value {
+	entries := make(map[any]mapEntry, len(m.entries))
+	for k, entry := range m.entries {
+		entries[k] = mapEntry{key: entry.key, val: Copy(entry.val)}
+	}
+	m.entries = entries
+	return m
+}
+func (m Map) Return(isReturn bool) Value {
+	m.IsReturn = isReturn
+	return m
+}
+
+// Keys returns the keys of m in ascending order.
+func (m Map) Keys() []Value {
+	keys := []Value{}
+	for _, entry := range m.entries {
+		keys = append(keys, entry.key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].(Cmp).Lt(keys[j].(Cmp)).Unwrap().(bool)
+	})
+	return keys
+}
+
+// LookupType is the type of looking up a key in a map of values of type val,
+// which is nil if the key isn't in the map.
+func LookupType(val TypeName) TypeName {
+	return TypeName{Name: "either", Vars: []TypeName{val, NewNil().TypeName()}}
+}
+
+// keyOf gets what key is stored by. NaN can't be a key, since it isn't equal to itself,
+// so it would never be found again.
+func (m Map) keyOf(key Value) (any, error) {
+	if !key.TypeName().Equal(m.Key) {
+		return nil, fmt.Errorf("map key must be `%s`, got `%s`", m.Key, key.TypeName())
+	}
+	if f, isFloat := key.Unwrap().(float64); isFloat && math.IsNaN(f) {
+		return nil, fmt.Errorf("map key cannot be NaN")
+	}
+	return key.Unwrap(), nil
+}
+
+func (m Map) lookup(key Value) (Value, error) {
+	k, err := m.keyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	var found Value = NewNil()
+	if entry, ok := m.entries[k]; ok {
+		found = entry.val
+	}
+	v, _ := Coerce(found, LookupType(m.Val))
+	return v, nil
+}
+
+func (m Map) insert(key, val Value) error {
+	k, err := m.keyOf(key)
+	if err != nil {
+		return err
+	}
+	coerced, ok := Coerce(val, m.Val)
+	if !ok {
+		return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", m.Val, val.TypeName())
+	}
+	m.entries[k] = mapEntry{key: key, val: Copy(coerced)}
+	return nil
+}
+
+// MapMethod finds the type of the builtin method name of maps from key to val.
+// Like the type of any method, it takes the map it is called on as its first argument.
+func MapMethod(key, val TypeName, name string) (TypeName, bool) {
+	m := MapType(key, val)
+	switch name {
+	case "has":
+		// whether the key is in the map
+		return FuncType([]TypeName{m, key}, NewBool(false).TypeName()), true
+	case "delete":
+		// a new map without the key
+		return FuncType([]TypeName{m, key}, m), true
+	case "keys":
+		// the keys in ascending order
+		return FuncType([]TypeName{m}, ListType(key)), true
+	case "values":
+		// the values, in the order of their keys
+		return FuncType([]TypeName{m}, ListType(val)), true
+	}
+	return TypeName{}, false
+}
+
+func (m Map) call(name string, args []Value) (Value, error) {
+	switch name {
+	case "has":
+		_, ok := m.entries[args[0].Unwrap()]
+		return NewBool(ok), nil
+	case "delete":
+		deleted := m.Copy().(Map)
+		delete(deleted.entries, args[0].Unwrap())
+		return deleted, nil
+	case "keys":
+		return NewList(m.Key, m.Keys())
+	case "values":
+		vals := []Value{}
+		for _, key := range m.Keys() {
+			vals = append(vals, m.entries[key.Unwrap()].val)
+		}
+		return NewList(m.Val, vals)
+	}
+	return nil, fmt.Errorf("method `%s` not found in type `%s`", name, m.TypeName())
+}
@@ -0,0 +1,35 @@
+package builtin
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+func TestMapNaNKey(t *testing.T) {
+	nan := NewFloat(math.NaN())
+	if _, err := NewMap(floatType, intType, []Value{nan}, []Value{NewInt(1)}); err == nil {
+		t.Error("built a map with a NaN key")
+	}
+
+	m, err := NewMap(floatType, intType, []Value{NewFloat(1.5)}, []Value{NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.insert(nan, NewInt(2)); err == nil || err.Error() != "map key cannot be NaN" {
+			t.Errorf("got error %v, want a NaN key to be rejected", err)
+		}
+	}
+	if _, err := m.lookup(nan); err == nil {
+		t.Error("looked up a NaN key")
+	}
+	// the map is unchanged and can still be gone through
+	if got, want := m.PrintString(), "map[float,int]{1.5: 1}"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if vals, err := m.call("values", nil); err != nil || vals.PrintString() != "list[int]{1}" {
+		t.Errorf("got values %v, %v", vals, err)
+	}
+}
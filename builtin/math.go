@@ -0,0 +1,115 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// unary and binary are the types of the math builtins that take and give one kind of number.
+func unary(num TypeName) TypeName  { return FuncType([]TypeName{num}, num) }
+func binary(num TypeName) TypeName { return FuncType([]TypeName{num, num}, num) }
+
+var mathFuncs = map[string]BuiltinFunc{
+	"int": {
+		Types: []TypeName{FuncType([]TypeName{intType}, intType), FuncType([]TypeName{floatType}, intType)},
+		call:  toInt,
+	},
+	"float": {
+		Types: []TypeName{FuncType([]TypeName{intType}, floatType), FuncType([]TypeName{floatType}, floatType)},
+		call: func(args []Value) (Value, error) {
+			if n, isInt := args[0].Unwrap().(int); isInt {
+				return NewFloat(float64(n)), nil
+			}
+			return args[0], nil
+		},
+	},
+	"abs": {
+		Types: []TypeName{unary(intType), unary(floatType)},
+		call: func(args []Value) (Value, error) {
+			if n, isInt := args[0].Unwrap().(int); isInt && n < 0 {
+				return NewInt(-n), nil
+			} else if isInt {
+				return args[0], nil
+			}
+			return NewFloat(math.Abs(args[0].Unwrap().(float64))), nil
+		},
+	},
+	"min": {
+		Types: []TypeName{binary(intType), binary(floatType)},
+		call:  func(args []Value) (Value, error) { return pick(args, true), nil },
+	},
+	"max": {
+		Types: []TypeName{binary(intType), binary(floatType)},
+		call:  func(args []Value) (Value, error) { return pick(args, false), nil },
+	},
+	"pow": {
+		Types: []TypeName{binary(intType), binary(floatType)},
+		call:  pow,
+	},
+	"sqrt":  floatFunc(math.Sqrt),
+	"floor": floatFunc(math.Floor),
+	"ceil":  floatFunc(math.Ceil),
+	"round": floatFunc(math.Round),
+}
+
+// floatFunc is a builtin that applies f to a float.
+func floatFunc(f func(float64) float64) BuiltinFunc {
+	return BuiltinFunc{
+		Types: []TypeName{unary(floatType)},
+		call: func(args []Value) (Value, error) {
+			return NewFloat(f(args[0].Unwrap().(float64))), nil
+		},
+	}
+}
+
+// toInt converts a number to an int, truncating a float toward zero.
+// A float that is NaN, infinite, or too big for an int can't be converted.
+func toInt(args []Value) (Value, error) {
+	f, isFloat := args[0].Unwrap().(float64)
+	if !isFloat {
+		return args[0], nil
+	}
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, fmt.Errorf("cannot convert %s to `int`", args[0].PrintString())
+	}
+	return NewInt(int(f)), nil
+}
+
+// pick gives the smaller of two numbers of the same type, or the bigger one if smaller is false.
+func pick(args []Value, smaller bool) Value {
+	if a, isInt := args[0].Unwrap().(int); isInt {
+		b := args[1].Unwrap().(int)
+		if (a < b) == smaller {
+			return args[0]
+		}
+		return args[1]
+	}
+	a, b := args[0].Unwrap().(float64), args[1].Unwrap().(float64)
+	if smaller {
+		return NewFloat(math.Min(a, b))
+	}
+	return NewFloat(math.Max(a, b))
+}
+
+// pow raises a number to a power. An int can only be raised to a power that isn't negative,
+// since the result wouldn't be an int.
+func pow(args []Value) (Value, error) {
+	base, isInt := args[0].Unwrap().(int)
+	if !isInt {
+		return NewFloat(math.Pow(args[0].Unwrap().(float64), args[1].Unwrap().(float64))), nil
+	}
+	exp := args[1].Unwrap().(int)
+	if exp < 0 {
+		return nil, fmt.Errorf("negative exponent %d for `int`", exp)
+	}
+	result := 1
+	for ; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return NewInt(result), nil
+}
@@ -0,0 +1,97 @@
+package builtin
+
+import (
+	"fmt"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// ReceiverError reports why methods can't be declared on the type typeName, or nil if they can.
+// lookup finds a type by name.
+func ReceiverError(typeName string, lookup func(name string) *Type) error {
+	if typeName == "either" || typeName == "list" || typeName == "map" {
+		return fmt.Errorf("cannot declare methods on `%s`", typeName)
+	}
+	t := lookup(typeName)
+	if t == nil {
+		return fmt.Errorf("type not found: %s", typeName)
+	}
+	if t.Alias != nil {
+		return fmt.Errorf("cannot declare methods on alias `%s`, declare them on `%s`", typeName, t.Alias)
+	}
+	return nil
+}
+
+// MethodOf finds the method name of the type of v.
+func MethodOf(v Value, name string, lookup func(name string) *Type) (Value, bool) {
+	t := lookup(v.TypeName().Name)
+	if t == nil {
+		return nil, false
+	}
+	method, ok := t.Methods[name]
+	return method.Value, ok
+}
+
+// NativeMethodType finds the type of the builtin method name of values of type receiver,
+// which only lists and maps have. Like the type of any method, it takes the receiver as its first argument.
+func NativeMethodType(receiver TypeName, name string) (TypeName, bool) {
+	switch {
+	case receiver.IsList():
+		return ListMethod(receiver.Vars[0], name)
+	case receiver.IsMap():
+		return MapMethod(receiver.Vars[0], receiver.Vars[1], name)
+	}
+	return TypeName{}, false
+}
+
+// native is a value with builtin methods, which call runs with arguments that have already been checked.
+type native interface {
+	Value
+	call(name string, args []Value) (Value, error)
+}
+
+// NativeMethod finds the builtin method name of v, which is called with the arguments after v.
+func NativeMethod(v Value, name string) (func(args ...Value) (Value, error), bool) {
+	receiver, isNative := v.(native)
+	if !isNative {
+		return nil, false
+	}
+	ty, ok := NativeMethodType(v.TypeName(), name)
+	if !ok {
+		return nil, false
+	}
+	params, _, _ := ty.FuncParts()
+	params = params[1:] // the receiver is already bound
+	return func(args ...Value) (Value, error) {
+		args, err := checkArgs(params, args)
+		if err != nil {
+			return nil, err
+		}
+		return receiver.call(name, args)
+	}, true
+}
+
+// Index gets the element of the list base at index, or looks up the key index in the map base.
+func Index(base, index Value) (Value, error) {
+	switch base := base.(type) {
+	case List:
+		return base.at(index)
+	case Map:
+		return base.lookup(index)
+	default:
+		return nil, fmt.Errorf("cannot index `%s`", base.TypeName())
+	}
+}
+
+// SetIndex stores val in the element of the list base at index, or at the key index of the map base.
+// base is updated in place, and keeps its own copy of val.
+func SetIndex(base, index, val Value) error {
+	switch base := base.(type) {
+	case List:
+		return base.setAt(index, val)
+	case Map:
+		return base.insert(index, val)
+	default:
+		return fmt.Errorf("cannot index `%s`", base.TypeName())
+	}
+}
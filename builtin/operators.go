@@ -1,7 +1,10 @@
 package builtin
 
 import (
+	"fmt"
+
 	"github.com/bigyihsuan/structlang/env"
+	"github.com/bigyihsuan/structlang/token"
 	"github.com/bigyihsuan/structlang/trees/ast"
 	. "github.com/bigyihsuan/structlang/value"
 )
@@ -21,7 +24,8 @@ type Sum interface {
 type Product interface {
 	Value
 	Mul(other Product) Value
-	Div(other Product) Value
+	Div(other Product) (Value, error)
+	Mod(other Product) (Value, error)
 }
 
 type Cmp interface {
@@ -48,3 +52,85 @@ type Call interface {
 type Eval interface {
 	Evaluate(currEnv *env.Env, stmts ...[]ast.Stmt) (Value, error)
 }
+
+// Prefix applies the prefix operator op to v.
+func Prefix(op token.TokenType, v Value) (Value, error) {
+	if neg, isNeg := v.(Neg); isNeg {
+		switch op {
+		case token.PLUS:
+			return neg.Pos(), nil
+		case token.MINUS:
+			return neg.Neg(), nil
+		}
+	}
+	if log, isLog := v.(Log); isLog {
+		switch op {
+		case token.NOT:
+			return log.Not(), nil
+		}
+	}
+
+	return v, fmt.Errorf("invalid type `%s` for prefix op `%s`", v.TypeName(), op)
+}
+
+// Infix applies the infix operator op to left and right, which must have the same type:
+// an int and a float are never converted to each other, and need `int` or `float` first.
+func Infix(op token.TokenType, left, right Value) (v Value, err error) {
+	if !left.TypeName().Equal(right.TypeName()) {
+		return v, fmt.Errorf("invalid types `%s` and `%s` for infix op `%s`", left.TypeName(), right.TypeName(), op)
+	}
+
+	lsum, isLsum := left.(Sum)
+	rsum, isRsum := right.(Sum)
+	if isLsum && isRsum {
+		switch op {
+		case token.PLUS:
+			return lsum.Add(rsum), nil
+		case token.MINUS:
+			return lsum.Sub(rsum), nil
+		}
+	}
+
+	lprod, isLprod := left.(Product)
+	rprod, isRprod := right.(Product)
+	if isLprod && isRprod {
+		switch op {
+		case token.STAR:
+			return lprod.Mul(rprod), nil
+		case token.SLASH:
+			return lprod.Div(rprod)
+		case token.PERCENT:
+			return lprod.Mod(rprod)
+		}
+	}
+
+	lcmp, isLcmp := left.(Cmp)
+	rcmp, isRcmp := right.(Cmp)
+	if isLcmp && isRcmp {
+		switch op {
+		case token.GT:
+			return lcmp.Gt(rcmp), nil
+		case token.GTEQ:
+			return lcmp.GtEq(rcmp), nil
+		case token.LT:
+			return lcmp.Lt(rcmp), nil
+		case token.LTEQ:
+			return lcmp.LtEq(rcmp), nil
+		case token.EQ:
+			return lcmp.Eq(rcmp), nil
+		}
+	}
+
+	llog, isLlog := left.(Log)
+	rlog, isRlog := right.(Log)
+	if isLlog && isRlog {
+		switch op {
+		case token.AND:
+			return llog.And(rlog), nil
+		case token.OR:
+			return llog.Or(rlog), nil
+		}
+	}
+
+	return v, fmt.Errorf("invalid types `%s` and `%s` for infix op `%s`", left.TypeName(), right.TypeName(), op)
+}
@@ -1,37 +1,90 @@
 package builtin
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/bigyihsuan/structlang/env"
 	. "github.com/bigyihsuan/structlang/value"
 )
 
+// Primitives declares the primitive types as structs. Every primitive has the fields
+//   - `v`: the value itself
+//   - `name`: the name of its type
+//   - `len`: the number of runes of a string, and 0 for everything else
+var Primitives = map[string]Type{
+	"int":    primitiveType("int"),
+	"float":  primitiveType("float"),
+	"bool":   primitiveType("bool"),
+	"string": primitiveType("string"),
+	"nil":    primitiveType("nil"),
+}
+
+func primitiveType(name string) Type {
+	return Type{
+		Fields: map[string]TypeName{
+			"v":    {Name: name, Vars: []TypeName{}},
+			"name": {Name: "string", Vars: []TypeName{}},
+			"len":  {Name: "int", Vars: []TypeName{}},
+		},
+		Vars: []TypeName{},
+	}
+}
+
+// IsPrimitive reports whether name is one of the primitive types.
+func IsPrimitive(name string) bool {
+	_, ok := Primitives[name]
+	return ok
+}
+
+// IsBuiltin reports whether name is a type that every program has, which can't be redefined:
+// one of the primitives, `either`, `list`, or `map`.
+func IsBuiltin(name string) bool {
+	return IsPrimitive(name) || name == "either" || name == "list" || name == "map"
+}
+
+// DefinePrimitives defines the primitive types in e, so that they can be looked up like any other type.
+func DefinePrimitives(e *env.Env) {
+	for name, ty := range Primitives {
+		e.DefineType(name, ty.Copy())
+	}
+}
+
+// primitiveField gets a field of the primitive v, as declared in Primitives, or nil if there is no such field.
+func primitiveField(v Value, field string) Value {
+	switch field {
+	case "v":
+		return v
+	case "name":
+		return NewString(v.TypeName().Name)
+	case "len":
+		if s, isString := v.Unwrap().(string); isString {
+			return NewInt(utf8.RuneCountInString(s))
+		}
+		return NewInt(0)
+	default:
+		return nil
+	}
+}
+
 type Primitive struct {
 	v        any
 	IsReturn bool
-	Struct
 }
 
 func NewPrimitive(v any) Primitive {
-	sv := Struct{Fields: make(map[string]Value)}
-	return Primitive{v: v, Struct: sv}
+	return Primitive{v: v}
 }
 
-var nilValue = func() (p Primitive) {
-	sv := Struct{Fields: make(map[string]Value)}
-	sv.Fields["name"] = NewPrimitive("nil")
-	sv.Fields["len"] = NewPrimitive(0)
-	p.v = nil
-	return
-}()
-
 func (p Primitive) PrintString() string {
 	return fmt.Sprintf("%v", p.v)
 }
 
 func NewNil() (p Primitive) {
-	return nilValue
+	return NewPrimitive(nil)
 }
 
 func (p Primitive) String() string {
@@ -39,10 +92,7 @@ func (p Primitive) String() string {
 }
 
 func (p Primitive) Get(field string) Value {
-	if field == "v" {
-		return p
-	}
-	return p.Struct.Get(field)
+	return primitiveField(p, field)
 }
 
 func (p Primitive) TypeName() TypeName {
@@ -55,10 +105,8 @@ func (p Primitive) TypeName() TypeName {
 		return TypeName{Name: "bool", Vars: []TypeName{}}
 	case string:
 		return TypeName{Name: "string", Vars: []TypeName{}}
-	case nil:
-		return TypeName{Name: "nil", Vars: []TypeName{}}
 	}
-	return nilValue.TypeName()
+	return TypeName{Name: "nil", Vars: []TypeName{}}
 }
 
 func (p Primitive) Unwrap() any {
@@ -79,16 +127,7 @@ func NewInt(v int) IntValue {
 }
 
 func (v IntValue) Get(field string) Value {
-	switch field {
-	case "v":
-		return v
-	case "name":
-		return NewString("int")
-	case "len":
-		return NewInt(0)
-	default:
-		return v.Struct.Get(field)
-	}
+	return primitiveField(v, field)
 }
 
 func (iv IntValue) Pos() Value {
@@ -112,15 +151,27 @@ func (iv IntValue) Mul(other Product) Value {
 	r := iv.Unwrap().(int) * other.Unwrap().(int)
 	return NewInt(r)
 }
-func (iv IntValue) Div(other Product) Value {
+
+// Div truncates toward zero, so -7 / 2 is -3.
+func (iv IntValue) Div(other Product) (Value, error) {
 	o := other.Unwrap().(int)
 	if o == 0 {
-		return NewInt(0)
+		return nil, errDivByZero
 	}
-	r := iv.Unwrap().(int) / o
-	return NewInt(r)
+	return NewInt(iv.Unwrap().(int) / o), nil
 }
 
+// Mod is the remainder of Div, which has the sign of iv, so -7 % 2 is -1.
+func (iv IntValue) Mod(other Product) (Value, error) {
+	o := other.Unwrap().(int)
+	if o == 0 {
+		return nil, errDivByZero
+	}
+	return NewInt(iv.Unwrap().(int) % o), nil
+}
+
+var errDivByZero = errors.New("integer division by zero")
+
 func (iv IntValue) Gt(other Cmp) Value {
 	return NewBool(iv.Unwrap().(int) > other.Unwrap().(int))
 }
@@ -146,16 +197,7 @@ func NewFloat(v float64) FloatValue {
 }
 
 func (v FloatValue) Get(field string) Value {
-	switch field {
-	case "v":
-		return v
-	case "name":
-		return NewString("float")
-	case "len":
-		return NewInt(0)
-	default:
-		return v.Struct.Get(field)
-	}
+	return primitiveField(v, field)
 }
 
 func (iv FloatValue) Pos() Value {
@@ -179,9 +221,17 @@ func (fv FloatValue) Mul(other Product) Value {
 	fv.v = fv.Unwrap().(float64) * other.Unwrap().(float64)
 	return fv
 }
-func (fv FloatValue) Div(other Product) Value {
+
+// Div follows IEEE 754, so dividing by zero gives an infinity or NaN instead of failing.
+func (fv FloatValue) Div(other Product) (Value, error) {
 	fv.v = fv.Unwrap().(float64) / other.Unwrap().(float64)
-	return fv
+	return fv, nil
+}
+
+// Mod is the remainder of fv / other truncated toward zero, which is NaN when other is zero.
+func (fv FloatValue) Mod(other Product) (Value, error) {
+	fv.v = math.Mod(fv.Unwrap().(float64), other.Unwrap().(float64))
+	return fv, nil
 }
 
 func (fv FloatValue) Gt(other Cmp) Value {
@@ -209,16 +259,7 @@ func NewBool(v bool) BoolValue {
 }
 
 func (v BoolValue) Get(field string) Value {
-	switch field {
-	case "v":
-		return v
-	case "name":
-		return NewString("bool")
-	case "len":
-		return NewInt(0)
-	default:
-		return v.Struct.Get(field)
-	}
+	return primitiveField(v, field)
 }
 
 func (bv BoolValue) Not() Value {
@@ -240,16 +281,7 @@ func NewString(v string) StringValue {
 }
 
 func (v StringValue) Get(field string) Value {
-	switch field {
-	case "v":
-		return v
-	case "name":
-		return NewString("string")
-	case "len":
-		return NewInt(len([]rune(v.Unwrap().(string))))
-	default:
-		return v.Struct.Get(field)
-	}
+	return primitiveField(v, field)
 }
 
 func (sv StringValue) Add(other Sum) Value {
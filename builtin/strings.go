@@ -0,0 +1,189 @@
+package builtin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+var (
+	intType    = NewInt(0).TypeName()
+	floatType  = NewFloat(0).TypeName()
+	boolType   = NewBool(false).TypeName()
+	stringType = NewString("").TypeName()
+	nilType    = NewNil().TypeName()
+	// anyPrimitive is the parameter of the builtins that take any primitive but nil
+	anyPrimitive = TypeName{Name: "either", Vars: []TypeName{intType, floatType, boolType, stringType}}
+)
+
+// parsed is the result of parsing a string as a value of type ty: the value, or the message saying why it isn't one.
+func parsed(ty TypeName) TypeName {
+	return TypeName{Name: "either", Vars: []TypeName{ty, stringType}}
+}
+
+var stringFuncs = map[string]BuiltinFunc{
+	"split": {
+		Types: []TypeName{FuncType([]TypeName{stringType, stringType}, ListType(stringType))},
+		call:  split,
+	},
+	"join": {
+		Types: []TypeName{FuncType([]TypeName{ListType(stringType), stringType}, stringType)},
+		call:  join,
+	},
+	"trim": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, stringType)},
+		call: func(args []Value) (Value, error) {
+			return NewString(strings.TrimSpace(str(args[0]))), nil
+		},
+	},
+	"contains": {
+		Types: []TypeName{FuncType([]TypeName{stringType, stringType}, boolType)},
+		call: func(args []Value) (Value, error) {
+			return NewBool(strings.Contains(str(args[0]), str(args[1]))), nil
+		},
+	},
+	"index": {
+		Types: []TypeName{FuncType([]TypeName{stringType, stringType}, LookupType(intType))},
+		call:  index,
+	},
+	"replace": {
+		Types: []TypeName{FuncType([]TypeName{stringType, stringType, stringType}, stringType)},
+		call: func(args []Value) (Value, error) {
+			return NewString(strings.ReplaceAll(str(args[0]), str(args[1]), str(args[2]))), nil
+		},
+	},
+	"upper": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, stringType)},
+		call: func(args []Value) (Value, error) {
+			return NewString(strings.ToUpper(str(args[0]))), nil
+		},
+	},
+	"lower": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, stringType)},
+		call: func(args []Value) (Value, error) {
+			return NewString(strings.ToLower(str(args[0]))), nil
+		},
+	},
+	"substring": {
+		Types: []TypeName{FuncType([]TypeName{stringType, intType, intType}, stringType)},
+		call:  substring,
+	},
+	"repeat": {
+		Types: []TypeName{FuncType([]TypeName{stringType, intType}, stringType)},
+		call:  repeat,
+	},
+	"string": {
+		Types: []TypeName{FuncType([]TypeName{anyPrimitive}, stringType)},
+		call: func(args []Value) (Value, error) {
+			return NewString(args[0].PrintString()), nil
+		},
+	},
+	"parseInt": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, parsed(intType))},
+		call:  parseInt,
+	},
+	"parseFloat": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, parsed(floatType))},
+		call:  parseFloat,
+	},
+	"parseBool": {
+		Types: []TypeName{FuncType([]TypeName{stringType}, parsed(boolType))},
+		call:  parseBool,
+	},
+}
+
+func str(v Value) string {
+	return v.Unwrap().(string)
+}
+
+// split splits a string around every occurrence of a separator, or into its runes if the separator is empty.
+func split(args []Value) (Value, error) {
+	parts := []Value{}
+	for _, part := range strings.Split(str(args[0]), str(args[1])) {
+		parts = append(parts, NewString(part))
+	}
+	return NewList(stringType, parts)
+}
+
+func join(args []Value) (Value, error) {
+	parts := []string{}
+	for _, part := range args[0].(List).Elems {
+		parts = append(parts, str(part))
+	}
+	return NewString(strings.Join(parts, str(args[1]))), nil
+}
+
+// index finds the rune position of the first occurrence of a substring, or nil if there is none.
+func index(args []Value) (Value, error) {
+	s, sub := str(args[0]), str(args[1])
+	var found Value = NewNil()
+	if i := strings.Index(s, sub); i >= 0 {
+		found = NewInt(len([]rune(s[:i])))
+	}
+	v, _ := Coerce(found, LookupType(intType))
+	return v, nil
+}
+
+// substring gets the runes from lo up to but not including hi, which are checked like the bounds of a list slice.
+func substring(args []Value) (Value, error) {
+	runes := []rune(str(args[0]))
+	lo, hi := args[1].Unwrap().(int), args[2].Unwrap().(int)
+	for _, i := range []int{lo, hi} {
+		if i < 0 || i > len(runes) {
+			return nil, fmt.Errorf("index %d out of range for `string` of length %d", i, len(runes))
+		}
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("invalid substring: %d is after %d", lo, hi)
+	}
+	return NewString(string(runes[lo:hi])), nil
+}
+
+// maxRepeat is the most bytes that repeat builds, which also keeps it from overflowing.
+const maxRepeat = 1 << 30
+
+func repeat(args []Value) (Value, error) {
+	s, n := str(args[0]), args[1].Unwrap().(int)
+	if n < 0 {
+		return nil, fmt.Errorf("negative repeat count %d", n)
+	}
+	if n > 0 && len(s) > maxRepeat/n {
+		return nil, fmt.Errorf("repeat count %d is too big for a string of %d bytes", n, len(s))
+	}
+	return NewString(strings.Repeat(s, n)), nil
+}
+
+func parseInt(args []Value) (Value, error) {
+	s := str(args[0])
+	var result Value = NewString(fmt.Sprintf("invalid int %q", s))
+	if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		result = NewInt(n)
+	}
+	v, _ := Coerce(result, parsed(intType))
+	return v, nil
+}
+
+func parseFloat(args []Value) (Value, error) {
+	s := str(args[0])
+	var result Value = NewString(fmt.Sprintf("invalid float %q", s))
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		result = NewFloat(f)
+	}
+	v, _ := Coerce(result, parsed(floatType))
+	return v, nil
+}
+
+func parseBool(args []Value) (Value, error) {
+	s := str(args[0])
+	var result Value = NewString(fmt.Sprintf("invalid bool %q", s))
+	switch strings.TrimSpace(s) {
+	case "true":
+		result = NewBool(true)
+	case "false":
+		result = NewBool(false)
+	}
+	v, _ := Coerce(result, parsed(boolType))
+	return v, nil
+}
@@ -0,0 +1,22 @@
+package builtin
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRepeat(t *testing.T) {
+	repeatFunc := builtinFuncs["repeat"]
+	got, err := repeatFunc.Call(NewString("ab"), NewInt(3))
+	if err != nil || got.PrintString() != "ababab" {
+		t.Errorf("got %v, %v, want ababab", got, err)
+	}
+	if got, err := repeatFunc.Call(NewString(""), NewInt(math.MaxInt)); err != nil || got.PrintString() != "" {
+		t.Errorf("got %v, %v, want an empty string", got, err)
+	}
+	for _, n := range []int{-1, math.MaxInt, maxRepeat/2 + 1} {
+		if _, err := repeatFunc.Call(NewString("ab"), NewInt(n)); err == nil {
+			t.Errorf("repeated %d times without an error", n)
+		}
+	}
+}
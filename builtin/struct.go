@@ -0,0 +1,114 @@
+package builtin
+
+import (
+	"fmt"
+
+	"github.com/bigyihsuan/structlang/util"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// NewStructLiteral instantiates template with the type vars of typeName
+// and checks the literal's fields against the instantiated field types.
+// An embedded struct can be given as a whole, or built from the promoted fields given for it;
+// lookup finds the types of embedded structs by name.
+func NewStructLiteral(template Type, typeName TypeName, fields []util.Pair[string, Value], lookup func(name string) *Type) (v Value, err error) {
+	if IsPrimitive(typeName.Name) {
+		return primitiveLiteral(typeName, fields)
+	}
+	if len(typeName.Vars) != len(template.Vars) {
+		return v, fmt.Errorf("not enough type parameters: want %d, got %d", len(template.Vars), len(typeName.Vars))
+	}
+
+	// overwrite template type variables with concrete types
+	typeParams := template.Params(typeName.Vars)
+	structTemplate := template.Instantiate(typeName.Vars)
+
+	values := make(map[string]Value)
+	promoted := make(map[string][]util.Pair[string, Value]) // the promoted fields given for each embedded field
+	for _, field := range fields {
+		name, val := field.First, field.Last
+		expFieldType, ok := structTemplate.Fields[name]
+		if !ok {
+			path, ambiguous := structTemplate.Promote(name, lookup)
+			if path == nil {
+				return v, fmt.Errorf("field `%s` not found in type `%s`", name, typeName.Name)
+			} else if ambiguous {
+				return v, fmt.Errorf("ambiguous field `%s` in type `%s`", name, typeName.Name)
+			}
+			promoted[path[0]] = append(promoted[path[0]], field)
+			continue
+		}
+		coerced, ok := Coerce(val, expFieldType)
+		if !ok {
+			return v, fmt.Errorf("unexpected type for field `%s`: got `%s`, want `%s`", name, val.TypeName(), expFieldType)
+		}
+		values[name] = Copy(coerced)
+	}
+	for _, embedded := range structTemplate.Embedded {
+		fields, ok := promoted[embedded]
+		if !ok {
+			continue
+		}
+		if _, given := values[embedded]; given {
+			return v, fmt.Errorf("field `%s` given both as a whole and through its promoted fields", embedded)
+		}
+		embeddedType := structTemplate.Fields[embedded]
+		embeddedTemplate := lookup(embeddedType.Name)
+		if embeddedTemplate == nil {
+			return v, fmt.Errorf("type not found: %s", embeddedType.Name)
+		}
+		values[embedded], err = NewStructLiteral(*embeddedTemplate, embeddedType, fields, lookup)
+		if err != nil {
+			return v, err
+		}
+	}
+	return NewStructFromType(structTemplate, typeParams, values, typeName), nil
+}
+
+// primitiveLiteral builds a primitive from a literal like `int{v: 1}`.
+// Only `v` can be given, since the other fields are worked out from it.
+func primitiveLiteral(typeName TypeName, fields []util.Pair[string, Value]) (v Value, err error) {
+	for _, field := range fields {
+		name, val := field.First, field.Last
+		if name != "v" {
+			return v, fmt.Errorf("field `%s` of `%s` can't be given, only `v`", name, typeName.Name)
+		}
+		coerced, ok := Coerce(val, typeName)
+		if !ok {
+			return v, fmt.Errorf("unexpected type for field `%s`: got `%s`, want `%s`", name, val.TypeName(), typeName)
+		}
+		v = coerced
+	}
+	if v == nil {
+		return v, fmt.Errorf("missing field `v` in struct literal of type `%s`", typeName.Name)
+	}
+	return v, nil
+}
+
+// SetField stores val in the field of base, which must be a struct.
+// base is updated in place, and keeps its own copy of val.
+func SetField(base Value, field string, val Value) error {
+	switch base := base.(type) {
+	case Struct:
+		// a promoted field is set in the embedded struct that has it
+		owner := base.Owner(field)
+		if owner == nil {
+			return fmt.Errorf("field `%s` not found in type `%s`", field, base.Type)
+		}
+		holder, isStruct := owner.(Struct)
+		if !isStruct {
+			return fmt.Errorf("cannot set field `%s` of `%s`", field, owner.TypeName())
+		}
+		want := holder.FieldTypes[field]
+		coerced, ok := Coerce(val, want)
+		if !ok {
+			return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", want, val.TypeName())
+		}
+		holder.Fields[field] = Copy(coerced)
+		return nil
+	case Either:
+		return fmt.Errorf("cannot set field `%s` of `%s`, use `match` to unwrap it", field, base.TypeName())
+	default:
+		return fmt.Errorf("cannot set field `%s` of `%s`", field, base.TypeName())
+	}
+}
@@ -0,0 +1,1198 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/ast"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Checker walks the AST before evaluation, infers the type of every expression,
+// and collects every type error it finds instead of stopping at the first one.
+type Checker struct {
+	Code       []ast.Stmt
+	BaseScope  Scope
+	errs       error
+	returns    []TypeName      // declared return types of the enclosing func literals, innermost last
+	loops      int             // the loops around the statement being checked, inside the innermost func literal
+	typeParams map[string]bool // type variables in scope while checking a type definition
+	Info       *Info           // if set, filled in with the definitions and uses of names
+}
+
+// unknown is the type of an expression that already produced an error.
+// It is compatible with every other type so one mistake doesn't cascade.
+var unknown = TypeName{Name: "?"}
+
+func NewChecker(code []ast.Stmt) Checker {
+	var c Checker
+	c.Code = code
+	universe := NewScope()
+	for name, ty := range builtin.Primitives {
+		universe.DefineType(name, ty.Copy())
+	}
+	c.BaseScope = universe.MakeChild()
+	return c
+}
+
+func (c *Checker) Check(currScope *Scope, stmts ...[]ast.Stmt) error {
+	code := c.Code
+	if len(stmts) > 0 {
+		code = stmts[0]
+	}
+	c.errs = nil
+	c.Stmts(currScope, code)
+	return c.errs
+}
+
+func (c *Checker) errorf(node ast.HasTokens, format string, args ...any) {
+	c.errs = errors.Join(c.errs, diag.Errorf(node, format, args...))
+}
+
+func (c *Checker) Stmts(currScope *Scope, stmts []ast.Stmt) {
+	c.hoist(currScope, stmts)
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case ast.TypeDef:
+			c.TypeDef(currScope, stmt)
+		case ast.VarDef:
+			c.VarDef(currScope, stmt)
+		case ast.VarSet:
+			c.VarSet(currScope, stmt)
+		case ast.ExprStmt:
+			c.Expr(currScope, stmt.Expr)
+		case ast.ReturnStmt:
+			c.ReturnStmt(currScope, stmt)
+		case ast.IfStmt:
+			c.Cond(currScope, stmt.Cond)
+			c.Block(currScope, stmt.Then)
+			if stmt.Else != nil {
+				c.Block(currScope, *stmt.Else)
+			}
+		case ast.WhileStmt:
+			c.Cond(currScope, stmt.Cond)
+			c.loops++
+			c.Block(currScope, stmt.Body)
+			c.loops--
+		case ast.ForStmt:
+			c.ForStmt(currScope, stmt)
+		case ast.BreakStmt:
+			if c.loops == 0 {
+				c.errorf(stmt, "`break` outside of a loop")
+			}
+		case ast.ContinueStmt:
+			if c.loops == 0 {
+				c.errorf(stmt, "`continue` outside of a loop")
+			}
+		case ast.MatchStmt:
+			c.MatchStmt(currScope, stmt)
+		case ast.MethodDef:
+			c.MethodDef(currScope, stmt)
+		default:
+			fmt.Printf("check unknown stmt: %T\n", stmt)
+		}
+	}
+}
+
+// hoist declares the functions defined in stmts up front, so that functions in the same block
+// can call each other no matter which one comes first.
+func (c *Checker) hoist(currScope *Scope, stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		varDef, isVarDef := stmt.(ast.VarDef)
+		if !isVarDef {
+			continue
+		}
+		ident, isIdent := varDef.Lvalue.(ast.Ident)
+		fd, isFunc := varDef.Rvalue.(ast.FuncDef)
+		if !isIdent || !isFunc {
+			continue
+		}
+		if _, defined := currScope.Variables[ident.Name]; defined {
+			// redefining a variable of this scope, whose old value is still visible until then
+			continue
+		}
+		var signature TypeName
+		c.quietly(func() { signature = c.funcSignature(currScope, fd) })
+		currScope.hoist(ident.Name, signature)
+	}
+}
+
+// variable looks up the type of a variable. A hoisted function can only be used before its `let`
+// from inside another function body. That isn't checked any further: calling the other function
+// before the `let` has been reached is a runtime error, since the variable isn't defined yet.
+func (c *Checker) variable(currScope *Scope, ident ast.Ident) TypeName {
+	inFunc := false
+	for s := currScope; s != nil; s = s.Parent {
+		if ty, ok := s.Variables[ident.Name]; ok {
+			if s.hoisted[ident.Name] && !inFunc {
+				c.errorf(ident, "function `%s` used before its definition", ident.Name)
+				return unknown
+			}
+			c.use(currScope, ident, false)
+			return ty
+		}
+		inFunc = inFunc || s.isFunc
+	}
+	c.errorf(ident, "variable `%s` not defined", ident.Name)
+	return unknown
+}
+
+func (c *Checker) Block(currScope *Scope, block ast.Block) {
+	blockScope := currScope.MakeChild()
+	c.scopeSpan(&blockScope, block)
+	c.Stmts(&blockScope, block.Stmts)
+}
+
+func (c *Checker) MatchStmt(currScope *Scope, stmt ast.MatchStmt) {
+	subject := c.Expr(currScope, stmt.Subject)
+	armTypes := []TypeName{}
+	for _, arm := range stmt.Arms {
+		armType := c.TypeName(currScope, arm.Type)
+		if !canHold(subject, armType) {
+			c.errorf(arm.Type, "`%s` is not an alternative of `%s`", armType, subject)
+		}
+		for _, prev := range armTypes {
+			if sameType(prev, armType) && armType.Name != unknown.Name {
+				c.errorf(arm.Type, "duplicate match arm for `%s`", armType)
+			}
+		}
+		armTypes = append(armTypes, armType)
+
+		armScope := currScope.MakeChild()
+		c.scopeSpan(&armScope, arm.Body)
+		if arm.Binding != nil {
+			armScope.DefineVariable(arm.Binding.Name, armType)
+			c.define(&armScope, *arm.Binding, armType, nil)
+		}
+		c.Stmts(&armScope, arm.Body.Stmts)
+	}
+	if !covered(subject, armTypes) {
+		c.errorf(stmt, "match on `%s` is not exhaustive", subject)
+	}
+}
+
+func (c *Checker) ForStmt(currScope *Scope, stmt ast.ForStmt) {
+	iterable := c.Expr(currScope, stmt.Iterable)
+	index, elem := TypeName{Name: "int"}, unknown
+	if stmt.End != nil {
+		end := c.Expr(currScope, stmt.End)
+		if !sameType(iterable, index) {
+			c.errorf(stmt.Iterable, "range bounds must be `int`, got `%s`", iterable)
+		}
+		if !sameType(end, index) {
+			c.errorf(stmt.End, "range bounds must be `int`, got `%s`", end)
+		}
+		elem = index
+	} else if iterable.Name != unknown.Name {
+		var err error
+		index, elem, err = builtin.IterType(iterable, stmt.Index != nil, func() (TypeName, bool) {
+			return c.iterMethod(currScope, iterable)
+		})
+		if err != nil {
+			c.errorf(stmt.Iterable, "%s", err)
+			index, elem = unknown, unknown
+		}
+	}
+
+	bodyScope := currScope.MakeChild()
+	c.scopeSpan(&bodyScope, stmt.Body)
+	if stmt.Index != nil {
+		bodyScope.DefineVariable(stmt.Index.Name, index)
+		c.define(&bodyScope, *stmt.Index, index, nil)
+	}
+	bodyScope.DefineVariable(stmt.Elem.Name, elem)
+	c.define(&bodyScope, stmt.Elem, elem, nil)
+	c.loops++
+	c.Stmts(&bodyScope, stmt.Body.Stmts)
+	c.loops--
+}
+
+// iterMethod finds the type of the `iter` method of iterable, with the type parameters of a generic struct filled in.
+func (c *Checker) iterMethod(currScope *Scope, iterable TypeName) (TypeName, bool) {
+	method, ok := c.method(currScope, iterable, builtin.IterMethod)
+	if !ok || !method.IsGeneric() {
+		return method, ok
+	}
+	typeArgs, err := method.Infer([]TypeName{iterable})
+	if err != nil {
+		return method, true
+	}
+	method, err = method.Instantiate(typeArgs)
+	return method, err == nil
+}
+
+func (c *Checker) Cond(currScope *Scope, expr ast.Expr) {
+	if cond := c.Expr(currScope, expr); !sameType(cond, TypeName{Name: "bool"}) {
+		c.errorf(expr, "condition must be `bool`, got `%s`", cond)
+	}
+}
+
+func (c *Checker) TypeDef(currScope *Scope, stmt ast.TypeDef) {
+	name := stmt.Type.Name.Name
+	if builtin.IsBuiltin(name) {
+		c.errorf(stmt, "cannot redefine builtin type `%s`", name)
+		return
+	}
+	if stmt.Alias != nil {
+		c.AliasDef(currScope, stmt)
+		return
+	}
+
+	st := Type{Fields: make(map[string]TypeName), Vars: []TypeName{}}
+	params := make(map[string]bool)
+	for _, typeVar := range stmt.StructDef.Vars {
+		if len(typeVar.Vars) > 0 {
+			c.errorf(typeVar, "type parameter `%s` cannot have type parameters", typeVar.Name.Name)
+		}
+		if params[typeVar.Name.Name] {
+			c.errorf(typeVar, "duplicate type parameter `%s`", typeVar.Name.Name)
+		}
+		params[typeVar.Name.Name] = true
+		st.Vars = append(st.Vars, TypeName{Name: typeVar.Name.Name})
+	}
+	if len(stmt.Type.Vars) != len(st.Vars) {
+		c.errorf(stmt.Type, "type parameters of `%s` do not match its struct: want %d, got %d", name, len(st.Vars), len(stmt.Type.Vars))
+	} else {
+		for i, typeVar := range stmt.Type.Vars {
+			if typeVar.Name.Name != st.Vars[i].Name {
+				c.errorf(typeVar, "type parameter `%s` does not match struct parameter `%s`", typeVar.Name.Name, st.Vars[i].Name)
+			}
+		}
+	}
+
+	// define the type before its fields so that recursive types resolve
+	currScope.DefineType(name, st)
+	c.define(currScope, stmt.Type.Name, TypeName{}, &st)
+
+	outer := c.typeParams
+	c.typeParams = params
+	defer func() { c.typeParams = outer }()
+	for _, field := range stmt.StructDef.Fields {
+		fieldType := c.TypeName(currScope, field.Type)
+		if field.IsEmbedded() {
+			embedded := field.Type.Name
+			switch {
+			case params[embedded.Name]:
+				c.errorf(field, "cannot embed type parameter `%s`", embedded.Name)
+			case fieldType.IsEither():
+				c.errorf(field, "cannot embed `%s`, use a named field", fieldType)
+			case embedded.Name == name:
+				c.errorf(field, "type `%s` cannot embed itself", name)
+			}
+			if _, exists := st.Fields[embedded.Name]; exists {
+				c.errorf(field, "duplicate field `%s` in type `%s`", embedded.Name, name)
+			}
+			st.Fields[embedded.Name] = fieldType
+			st.Embedded = append(st.Embedded, embedded.Name)
+		}
+		for _, fieldName := range field.Names {
+			if _, exists := st.Fields[fieldName.Name]; exists {
+				c.errorf(fieldName, "duplicate field `%s` in type `%s`", fieldName.Name, name)
+			}
+			st.Fields[fieldName.Name] = fieldType
+		}
+	}
+	// the fields are shared with the predefined type, but not the embedded fields
+	currScope.DefineType(name, st)
+}
+
+// AliasDef checks `type name = other;`. The alias is resolved here,
+// so every use of it is the aliased type itself.
+func (c *Checker) AliasDef(currScope *Scope, stmt ast.TypeDef) {
+	st := Type{Fields: make(map[string]TypeName), Vars: []TypeName{}}
+	params := make(map[string]bool)
+	for _, typeVar := range stmt.Type.Vars {
+		if len(typeVar.Vars) > 0 {
+			c.errorf(typeVar, "type parameter `%s` cannot have type parameters", typeVar.Name.Name)
+		}
+		if params[typeVar.Name.Name] {
+			c.errorf(typeVar, "duplicate type parameter `%s`", typeVar.Name.Name)
+		}
+		params[typeVar.Name.Name] = true
+		st.Vars = append(st.Vars, TypeName{Name: typeVar.Name.Name})
+	}
+	outer := c.typeParams
+	c.typeParams = params
+	alias := c.TypeName(currScope, *stmt.Alias)
+	c.typeParams = outer
+	st.Alias = &alias
+
+	currScope.DefineType(stmt.Type.Name.Name, st)
+	c.define(currScope, stmt.Type.Name, TypeName{}, &st)
+}
+
+// TypeName resolves an ast.Type against the declared types, reporting undefined names
+// and wrong numbers of type arguments.
+func (c *Checker) TypeName(currScope *Scope, typename ast.Type) TypeName {
+	name := typename.Name.Name
+	vars := []TypeName{}
+	for _, typeArg := range typename.Vars {
+		vars = append(vars, c.TypeName(currScope, typeArg))
+	}
+
+	if name == "either" {
+		if len(vars) != 2 {
+			c.errorf(typename, "wrong number of type parameters for `either`: want 2, got %d", len(vars))
+			return unknown
+		}
+		return TypeName{Name: name, Vars: vars}
+	}
+	if name == "list" {
+		if len(vars) != 1 {
+			c.errorf(typename, "wrong number of type parameters for `list`: want 1, got %d", len(vars))
+			return unknown
+		}
+		return TypeName{Name: name, Vars: vars}
+	}
+	if name == "map" {
+		if len(vars) != 2 {
+			c.errorf(typename, "wrong number of type parameters for `map`: want 2, got %d", len(vars))
+			return unknown
+		}
+		if err := builtin.KeyError(vars[0]); err != nil && vars[0].Name != unknown.Name && !c.typeParams[vars[0].Name] {
+			// a type parameter is checked once it is filled in
+			c.errorf(typename.Vars[0], "%s", err)
+			return unknown
+		}
+		return TypeName{Name: name, Vars: vars}
+	}
+	if name == "func" {
+		// the parser always gives function types their return type as the last type var
+		return TypeName{Name: name, Vars: vars}
+	}
+	if c.typeParams[name] || isPrimitive(name) {
+		if len(vars) > 0 {
+			c.errorf(typename, "type `%s` does not take type parameters", name)
+			return unknown
+		}
+		return TypeName{Name: name, Vars: vars}
+	}
+	st := currScope.GetType(name)
+	if st == nil {
+		c.errorf(typename, "type not found: %s", name)
+		return unknown
+	}
+	c.use(currScope, typename.Name, true)
+	if len(vars) != len(st.Vars) {
+		c.errorf(typename, "wrong number of type parameters for `%s`: want %d, got %d", name, len(st.Vars), len(vars))
+		return unknown
+	}
+	if st.Alias != nil {
+		return st.Alias.Substitute(st.Params(vars))
+	}
+	return TypeName{Name: name, Vars: vars}
+}
+
+func (c *Checker) VarDef(currScope *Scope, varDef ast.VarDef) {
+	ident, isIdent := varDef.Lvalue.(ast.Ident)
+	if !isIdent {
+		c.errorf(varDef.Lvalue, "cannot define a field access with `let`, use `set`")
+		c.Expr(currScope, varDef.Rvalue)
+		return
+	}
+	if builtin.IsBuiltinFunc(ident.Name) {
+		// calls would still go to the builtin
+		c.errorf(ident, "cannot redefine builtin function `%s`", ident.Name)
+	}
+	// a function declared ahead of its `let` is being defined, not redefined
+	prev, redefined := currScope.Variables[ident.Name]
+	redefined = redefined && !currScope.hoisted[ident.Name]
+	// predeclare functions so that they can call themselves
+	var def *Def
+	if fd, isFunc := varDef.Rvalue.(ast.FuncDef); isFunc {
+		var signature TypeName
+		c.quietly(func() { signature = c.funcSignature(currScope, fd) })
+		currScope.DefineVariable(ident.Name, signature)
+		delete(currScope.hoisted, ident.Name)
+		def = c.define(currScope, ident, signature, nil)
+	}
+	rvalue := c.Expr(currScope, varDef.Rvalue)
+	if redefined && !sameType(prev, rvalue) {
+		// the functions that use the old variable would see a value of the wrong type
+		c.errorf(ident, "cannot redefine `%s` of type `%s` as `%s` in the same scope", ident.Name, prev, rvalue)
+	}
+	currScope.DefineVariable(ident.Name, rvalue)
+	if def != nil {
+		def.Type = rvalue
+	} else {
+		c.define(currScope, ident, rvalue, nil)
+	}
+}
+
+func (c *Checker) VarSet(currScope *Scope, varSet ast.VarSet) {
+	var lvalue TypeName
+	switch lv := varSet.Lvalue.(type) {
+	case ast.Ident:
+		lvalue = c.variable(currScope, lv)
+	case ast.Index:
+		// the element itself, not the result of looking it up
+		_, lvalue = c.index(currScope, lv)
+	case ast.FieldAccess:
+		base := c.Expr(currScope, lv.Lvalue)
+		if base.IsEither() {
+			c.errorf(lv.Field, "cannot set field `%s` of `%s`, use `match` to unwrap it", lv.Field.Name, base)
+			lvalue = unknown
+		} else if isPrimitive(base.Name) || base.IsList() || base.IsMap() {
+			c.errorf(lv.Field, "cannot set field `%s` of `%s`", lv.Field.Name, base)
+			lvalue = unknown
+		} else {
+			lvalue = c.fieldType(currScope, base, lv.Field)
+		}
+	default:
+		lvalue = c.Expr(currScope, lv)
+	}
+	rvalue := c.Expr(currScope, varSet.Rvalue)
+	if !assignable(lvalue, rvalue) {
+		c.errorf(varSet.Rvalue, "mismatched types: want to set `%s`, got `%s`", lvalue, rvalue)
+	}
+}
+
+func (c *Checker) ReturnStmt(currScope *Scope, stmt ast.ReturnStmt) {
+	var got TypeName
+	if stmt.Expr != nil {
+		got = c.Expr(currScope, stmt.Expr)
+	} else {
+		got = TypeName{Name: "nil"}
+	}
+	if len(c.returns) == 0 {
+		// top-level return just stops the program
+		return
+	}
+	want := c.returns[len(c.returns)-1]
+	if !assignable(want, got) {
+		c.errorf(stmt, "mismatched return type: want `%s`, got `%s`", want, got)
+	}
+}
+
+func (c *Checker) Expr(currScope *Scope, expr ast.Expr) TypeName {
+	switch expr := expr.(type) {
+	case ast.Literal:
+		return c.Literal(expr)
+	case ast.Ident:
+		return c.variable(currScope, expr)
+	case ast.StructLiteral:
+		return c.StructLiteral(currScope, expr)
+	case ast.ListLiteral:
+		return c.ListLiteral(currScope, expr)
+	case ast.MapLiteral:
+		return c.MapLiteral(currScope, expr)
+	case ast.FieldAccess:
+		return c.FieldAccess(currScope, expr)
+	case ast.Index:
+		return c.Index(currScope, expr)
+	case ast.PrefixExpr:
+		return c.PrefixExpr(currScope, expr)
+	case ast.InfixExpr:
+		return c.InfixExpr(currScope, expr)
+	case ast.GroupingExpr:
+		return c.Expr(currScope, expr.Expr)
+	case ast.FuncCallExpr:
+		return c.FuncCallExpr(currScope, expr)
+	case ast.FuncDef:
+		return c.FuncDef(currScope, expr)
+	case ast.Instantiation:
+		fn := c.variable(currScope, expr.Name)
+		if fn.Name == unknown.Name {
+			return unknown
+		}
+		return c.instantiate(currScope, expr.Name, fn, expr.TypeArgs, nil)
+	case ast.IsExpr:
+		left := c.Expr(currScope, expr.Left)
+		ty := c.TypeName(currScope, expr.Type)
+		if !canHold(left, ty) {
+			c.errorf(expr, "a `%s` can never be a `%s`", left, ty)
+		}
+		return TypeName{Name: "bool"}
+	default:
+		fmt.Printf("check unknown expr: %T\n", expr)
+	}
+	return unknown
+}
+
+func (c *Checker) Literal(expr ast.Literal) TypeName {
+	switch expr.Token.Type() {
+	case token.INT:
+		return TypeName{Name: "int"}
+	case token.FLOAT:
+		return TypeName{Name: "float"}
+	case token.TRUE, token.FALSE:
+		return TypeName{Name: "bool"}
+	case token.STRING:
+		return TypeName{Name: "string"}
+	case token.NIL:
+		return TypeName{Name: "nil"}
+	default:
+		c.errorf(expr, "unknown literal %s", expr.Token.Type().String())
+		return unknown
+	}
+}
+
+func (c *Checker) StructLiteral(currScope *Scope, expr ast.StructLiteral) TypeName {
+	typename := expr.TypeName.Name.Name
+	st := currScope.GetType(typename)
+	if st == nil {
+		if typename == "list" {
+			c.errorf(expr.TypeName, "cannot give fields to `list`, give its elements")
+		} else {
+			c.errorf(expr.TypeName, "type not found: %s", typename)
+		}
+		for _, field := range expr.Fields {
+			c.Expr(currScope, field.Value)
+		}
+		return unknown
+	}
+	c.use(currScope, expr.TypeName.Name, true)
+
+	typeVars := []TypeName{}
+	for _, typeVar := range expr.TypeName.Vars {
+		typeVars = append(typeVars, c.TypeName(currScope, typeVar))
+	}
+	if len(typeVars) != len(st.Vars) {
+		c.errorf(expr.TypeName, "not enough type parameters: want %d, got %d", len(st.Vars), len(typeVars))
+		return unknown
+	}
+	if st.Alias != nil {
+		// build the aliased type instead
+		alias := st.Alias.Substitute(st.Params(typeVars))
+		st = currScope.GetType(alias.Name)
+		if st == nil {
+			if alias.Name != unknown.Name {
+				c.errorf(expr.TypeName, "cannot build `%s` with a struct literal", alias)
+			}
+			for _, field := range expr.Fields {
+				c.Expr(currScope, field.Value)
+			}
+			return alias
+		}
+		typename, typeVars = alias.Name, alias.Vars
+	}
+
+	fields := []literalField{}
+	for _, field := range expr.Fields {
+		fields = append(fields, literalField{StructLiteralField: field, ty: c.Expr(currScope, field.Value)})
+	}
+	ty := TypeName{Name: typename, Vars: typeVars}
+	c.literalFields(currScope, expr, ty, *st, fields)
+	return ty
+}
+
+func (c *Checker) ListLiteral(currScope *Scope, expr ast.ListLiteral) TypeName {
+	ty := c.TypeName(currScope, expr.TypeName)
+	elems := []TypeName{}
+	for _, elem := range expr.Elems {
+		elems = append(elems, c.Expr(currScope, elem))
+	}
+	if ty.Name == unknown.Name {
+		return unknown
+	}
+	if !ty.IsList() {
+		c.errorf(expr.TypeName, "cannot build `%s` with a list literal", ty)
+		return unknown
+	}
+	for i, elem := range elems {
+		if !assignable(ty.Vars[0], elem) {
+			c.errorf(expr.Elems[i], "unexpected type for element %d of `%s`: got `%s`, want `%s`", i, ty, elem, ty.Vars[0])
+		}
+	}
+	return ty
+}
+
+func (c *Checker) MapLiteral(currScope *Scope, expr ast.MapLiteral) TypeName {
+	ty := c.TypeName(currScope, expr.TypeName)
+	keys, vals := []TypeName{}, []TypeName{}
+	for _, entry := range expr.Entries {
+		keys = append(keys, c.Expr(currScope, entry.Key))
+		vals = append(vals, c.Expr(currScope, entry.Value))
+	}
+	if ty.Name == unknown.Name {
+		return unknown
+	}
+	if !ty.IsMap() {
+		c.errorf(expr.TypeName, "cannot build `%s` with a map literal", ty)
+		return unknown
+	}
+	for i, entry := range expr.Entries {
+		if !assignable(ty.Vars[0], keys[i]) {
+			c.errorf(entry.Key, "map key must be `%s`, got `%s`", ty.Vars[0], keys[i])
+		}
+		if !assignable(ty.Vars[1], vals[i]) {
+			c.errorf(entry.Value, "unexpected type for value of `%s`: got `%s`, want `%s`", ty, vals[i], ty.Vars[1])
+		}
+	}
+	return ty
+}
+
+type literalField struct {
+	ast.StructLiteralField
+	ty TypeName
+}
+
+// literalFields checks the fields given in a struct literal of type ty, which is defined as template.
+// Promoted fields are checked as if the embedded struct they belong to was built from them.
+func (c *Checker) literalFields(currScope *Scope, expr ast.StructLiteral, ty TypeName, template Type, fields []literalField) {
+	typename := ty.Name
+	st := template.Instantiate(ty.Vars)
+	seen := make(map[string]bool)
+	promoted := make(map[string][]literalField)
+	for _, field := range fields {
+		name := field.Name.Name
+		fieldType, ok := st.Fields[name]
+		if !ok {
+			path, ambiguous := st.Promote(name, currScope.GetType)
+			if path == nil {
+				c.errorf(field, "field `%s` not found in type `%s`", name, typename)
+			} else if ambiguous {
+				c.errorf(field, "ambiguous field `%s` in type `%s`", name, typename)
+			} else {
+				promoted[path[0]] = append(promoted[path[0]], field)
+			}
+			continue
+		}
+		if seen[name] {
+			c.errorf(field, "duplicate field `%s` in struct literal", name)
+		}
+		seen[name] = true
+		if isPrimitive(typename) && name != "v" {
+			c.errorf(field, "field `%s` of `%s` can't be given, only `v`", name, typename)
+			continue
+		}
+		if !assignable(fieldType, field.ty) {
+			c.errorf(field.Value, "unexpected type for field `%s`: got `%s`, want `%s`", name, field.ty, fieldType)
+		}
+	}
+	for _, embedded := range st.Embedded {
+		fields, ok := promoted[embedded]
+		if !ok {
+			continue
+		}
+		if seen[embedded] {
+			c.errorf(fields[0], "field `%s` given both as a whole and through its promoted fields", embedded)
+			continue
+		}
+		seen[embedded] = true
+		embeddedType := st.Fields[embedded]
+		if inner := currScope.GetType(embeddedType.Name); inner != nil {
+			c.literalFields(currScope, expr, embeddedType, *inner, fields)
+		}
+	}
+	for name := range st.Fields {
+		if !seen[name] && (name == "v" || !isPrimitive(typename)) {
+			c.errorf(expr, "missing field `%s` in struct literal of type `%s`", name, typename)
+		}
+	}
+}
+
+func (c *Checker) FieldAccess(currScope *Scope, expr ast.FieldAccess) TypeName {
+	base := c.Expr(currScope, expr.Lvalue)
+	return c.fieldType(currScope, base, expr.Field)
+}
+
+// Index checks `base->[index]`, which is an element of a list, or the lookup of a key in a map.
+func (c *Checker) Index(currScope *Scope, expr ast.Index) TypeName {
+	base, elem := c.index(currScope, expr)
+	if base.IsMap() {
+		return builtin.LookupType(elem)
+	}
+	return elem
+}
+
+// index finds the types of what expr indexes and of the elements stored in it, which are the values of a map.
+func (c *Checker) index(currScope *Scope, expr ast.Index) (base, elem TypeName) {
+	base = c.Expr(currScope, expr.Lvalue)
+	index := c.Expr(currScope, expr.Index)
+	switch {
+	case base.Name == unknown.Name:
+		return unknown, unknown
+	case base.IsList():
+		if !sameType(index, TypeName{Name: "int"}) {
+			c.errorf(expr.Index, "index must be `int`, got `%s`", index)
+		}
+		return base, base.Vars[0]
+	case base.IsMap():
+		if !assignable(base.Vars[0], index) {
+			c.errorf(expr.Index, "map key must be `%s`, got `%s`", base.Vars[0], index)
+		}
+		return base, base.Vars[1]
+	}
+	c.errorf(expr, "cannot index `%s`", base)
+	return unknown, unknown
+}
+
+func (c *Checker) fieldType(currScope *Scope, base TypeName, field ast.Ident) TypeName {
+	if base.Name == unknown.Name {
+		return unknown
+	}
+	if _, isMethod := builtin.NativeMethodType(base, field.Name); isMethod {
+		c.errorf(field, "method `%s` of `%s` can only be called", field.Name, base)
+		return unknown
+	}
+	if base.IsEither() || base.IsList() || base.IsMap() {
+		switch field.Name {
+		case "v":
+			return base
+		case "name":
+			return TypeName{Name: "string"}
+		case "len":
+			return TypeName{Name: "int"}
+		}
+		if !base.IsEither() {
+			c.errorf(field, "field `%s` not found in type `%s`", field.Name, base)
+		} else {
+			c.errorf(field, "field `%s` not found in type `%s`, use `match` to unwrap it", field.Name, base)
+		}
+		return unknown
+	}
+	st := currScope.GetType(base.Name)
+	if st == nil {
+		c.errorf(field, "type `%s` has no fields", base)
+		return unknown
+	}
+	if _, isMethod := st.Methods[field.Name]; isMethod {
+		c.errorf(field, "method `%s` of `%s` can only be called", field.Name, base)
+		return unknown
+	}
+	inst := st.Instantiate(base.Vars)
+	if fieldType, ok := inst.Fields[field.Name]; ok {
+		return fieldType
+	}
+	path, ambiguous := inst.Promote(field.Name, currScope.GetType)
+	if path == nil {
+		c.errorf(field, "field `%s` not found in type `%s`", field.Name, base)
+		return unknown
+	} else if ambiguous {
+		c.errorf(field, "ambiguous field `%s` in type `%s`", field.Name, base)
+		return unknown
+	}
+	// follow the embedded fields down to the promoted one
+	for _, name := range path[:len(path)-1] {
+		embedded := inst.Fields[name]
+		inst = currScope.GetType(embedded.Name).Instantiate(embedded.Vars)
+	}
+	return inst.Fields[field.Name]
+}
+
+func (c *Checker) PrefixExpr(currScope *Scope, expr ast.PrefixExpr) TypeName {
+	right := c.Expr(currScope, expr.Right)
+	if right.Name == unknown.Name {
+		return unknown
+	}
+	switch expr.Op.Type() {
+	case token.PLUS, token.MINUS:
+		if right.Name == "int" || right.Name == "float" {
+			return right
+		}
+	case token.NOT:
+		if right.Name == "bool" {
+			return right
+		}
+	}
+	c.errorf(expr, "invalid type `%s` for prefix op `%s`", right, expr.Op.Type())
+	return unknown
+}
+
+func (c *Checker) InfixExpr(currScope *Scope, expr ast.InfixExpr) TypeName {
+	left := c.Expr(currScope, expr.Left)
+	right := c.Expr(currScope, expr.Right)
+	if left.Name == unknown.Name || right.Name == unknown.Name {
+		return unknown
+	}
+
+	var allowed []string
+	result := left
+	switch expr.Op.Type() {
+	case token.PLUS, token.MINUS:
+		allowed = []string{"int", "float", "string"}
+	case token.STAR, token.SLASH, token.PERCENT:
+		allowed = []string{"int", "float"}
+	case token.GT, token.GTEQ, token.LT, token.LTEQ, token.EQ:
+		allowed = []string{"int", "float", "string"}
+		result = TypeName{Name: "bool"}
+	case token.AND, token.OR:
+		allowed = []string{"bool"}
+	}
+	if sameType(left, right) {
+		for _, name := range allowed {
+			if left.Name == name {
+				return result
+			}
+		}
+	}
+	c.errorf(expr, "invalid types `%s` and `%s` for infix op `%s`", left, right, expr.Op.Type())
+	return unknown
+}
+
+func (c *Checker) FuncCallExpr(currScope *Scope, expr ast.FuncCallExpr) TypeName {
+	args := []TypeName{}
+	for _, a := range expr.Args {
+		args = append(args, c.Expr(currScope, a))
+	}
+	argNodes := expr.Args
+
+	var fn TypeName
+	if builtinFn, isBuiltin := builtinFunc(expr.Name); isBuiltin {
+		if builtinFn.IsVariadic() {
+			return TypeName{Name: "nil"}
+		}
+		fn = c.overload(expr, builtinFn, args)
+	} else if fa, isFieldAccess := expr.Name.(ast.FieldAccess); isFieldAccess {
+		// a method of the receiver, or a function in one of its fields
+		receiver := c.Expr(currScope, fa.Lvalue)
+		if method, isMethod := c.method(currScope, receiver, fa.Field.Name); isMethod {
+			fn = method
+			args = append([]TypeName{receiver}, args...)
+			argNodes = append([]ast.Expr{fa.Lvalue}, argNodes...)
+		} else {
+			fn = c.fieldType(currScope, receiver, fa.Field)
+		}
+	} else {
+		fn = c.Expr(currScope, expr.Name)
+	}
+	if fn.Name == unknown.Name {
+		return unknown
+	}
+	if fn.IsGeneric() || len(expr.TypeArgs) > 0 {
+		fn = c.instantiate(currScope, expr.Name, fn, expr.TypeArgs, args)
+		if fn.Name == unknown.Name {
+			return unknown
+		}
+	}
+	params, ret, isFunc := fn.FuncParts()
+	if !isFunc {
+		c.errorf(expr.Name, "cannot call non-function of type `%s`", fn)
+		return unknown
+	}
+	if len(args) != len(params) {
+		// the receiver of a method isn't counted
+		receivers := len(argNodes) - len(expr.Args)
+		c.errorf(expr, "incorrect numbers of arguments for func: got %d, want %d", len(args)-receivers, len(params)-receivers)
+		return ret
+	}
+	for i, arg := range args {
+		if !assignable(params[i], arg) {
+			c.errorf(argNodes[i], "incorrect argument type for func: got `%s`, want `%s`", arg, params[i])
+		}
+	}
+	return ret
+}
+
+// builtinFunc finds the builtin function that a call of name calls, which comes before any variable.
+func builtinFunc(name ast.Expr) (builtin.BuiltinFunc, bool) {
+	ident, isIdent := name.(ast.Ident)
+	if !isIdent {
+		return builtin.BuiltinFunc{}, false
+	}
+	builtinFn, isBuiltin := builtin.BuiltinFuncs()[ident.Name]
+	return builtinFn, isBuiltin
+}
+
+// overload picks the first type of a builtin function that takes args.
+// A function with a single type is checked like any other, so that its errors point at the wrong argument.
+func (c *Checker) overload(expr ast.FuncCallExpr, builtinFn builtin.BuiltinFunc, args []TypeName) TypeName {
+	if len(builtinFn.Types) == 1 {
+		return builtinFn.Types[0]
+	}
+	for _, ty := range builtinFn.Types {
+		if params, _, _ := ty.FuncParts(); len(params) == len(args) {
+			takesArgs := true
+			for i, arg := range args {
+				takesArgs = takesArgs && assignable(params[i], arg)
+			}
+			if takesArgs {
+				return ty
+			}
+		}
+	}
+	c.errorf(expr, "incorrect argument types for func: got `%s`, want %s", builtin.Signature(args), builtinFn.Signatures())
+	return unknown
+}
+
+// method finds the type of the method name of the type receiver.
+func (c *Checker) method(currScope *Scope, receiver TypeName, name string) (TypeName, bool) {
+	if receiver.IsList() || receiver.IsMap() {
+		return builtin.NativeMethodType(receiver, name)
+	}
+	if receiver.IsEither() {
+		return unknown, false
+	}
+	st := currScope.GetType(receiver.Name)
+	if st == nil {
+		return unknown, false
+	}
+	method, ok := st.Methods[name]
+	return method.Type, ok
+}
+
+// MethodDef checks `func (r T) name(...) { ... }` and adds the method to T.
+// The method is added before its body is checked, so that it can call itself.
+func (c *Checker) MethodDef(currScope *Scope, stmt ast.MethodDef) {
+	typeName := stmt.Receiver.Type.Name.Name
+	st := currScope.GetType(typeName)
+	if err := builtin.ReceiverError(typeName, currScope.GetType); err != nil {
+		if st != nil || builtin.IsBuiltin(typeName) {
+			// a missing type is reported by the function
+			c.errorf(stmt.Receiver.Type, "%s", err)
+		}
+		c.FuncDef(currScope, stmt.Func)
+		return
+	}
+	name := stmt.Name.Name
+	if _, isField := st.Fields[name]; isField {
+		c.errorf(stmt.Name, "type `%s` already has a field `%s`", typeName, name)
+	} else if _, isMethod := st.Methods[name]; isMethod {
+		c.errorf(stmt.Name, "method `%s` already declared on `%s`", name, typeName)
+	}
+	for _, typeVar := range stmt.Receiver.Type.Vars {
+		if st := currScope.GetType(typeVar.Name.Name); st != nil && len(typeVar.Vars) == 0 {
+			c.errorf(typeVar, "the receiver of a method must name the type parameters of `%s`, not give them", typeName)
+		}
+	}
+
+	var signature TypeName
+	c.quietly(func() { signature = c.funcSignature(currScope, stmt.Func) })
+	currScope.DefineMethod(typeName, name, Method{Type: signature})
+
+	signature = c.FuncDef(currScope, stmt.Func)
+	currScope.DefineMethod(typeName, name, Method{Type: signature})
+}
+
+// instantiate fills in the type parameters of the generic function type fn.
+// If no type arguments are given, they are inferred from the types of the arguments of a call.
+func (c *Checker) instantiate(currScope *Scope, node ast.HasTokens, fn TypeName, typeArgs []ast.Type, args []TypeName) TypeName {
+	if !fn.IsGeneric() {
+		c.errorf(node, "cannot give type parameters to non-generic `%s`", fn)
+		return unknown
+	}
+	types := []TypeName{}
+	for _, typeArg := range typeArgs {
+		types = append(types, c.TypeName(currScope, typeArg))
+	}
+	if len(typeArgs) == 0 {
+		inferred, err := fn.Infer(args)
+		if err != nil {
+			c.errorf(node, "%s, give the type parameters with `[...]`", err)
+			return unknown
+		}
+		types = inferred
+	}
+	instance, err := fn.Instantiate(types)
+	if err != nil {
+		c.errorf(node, "%s", err)
+		return unknown
+	}
+	return instance
+}
+
+func (c *Checker) FuncDef(currScope *Scope, expr ast.FuncDef) TypeName {
+	signature := c.funcSignature(currScope, expr)
+	params, ret, _ := signature.FuncParts()
+	// the body sees the type parameters as types that it knows nothing about
+	outer := c.typeParams
+	c.typeParams = c.funcTypeParams(expr, false)
+	defer func() { c.typeParams = outer }()
+
+	funcScope := currScope.MakeChild()
+	funcScope.isFunc = true
+	c.scopeSpan(&funcScope, expr)
+	for i, arg := range expr.Args {
+		funcScope.DefineVariable(arg.Name.Name, params[i])
+		c.define(&funcScope, arg.Name, params[i], nil)
+	}
+	c.returns = append(c.returns, ret)
+	loops := c.loops
+	c.loops = 0
+	c.Stmts(&funcScope, expr.Body)
+	c.loops = loops
+	c.returns = c.returns[:len(c.returns)-1]
+	if !assignable(ret, TypeName{Name: "nil"}) && ret.Name != unknown.Name && !expr.Broken && !terminates(expr.Body) {
+		// falling off the end returns nil, which ret can't hold.
+		// a body missing statements that didn't parse may have lost its return with them
+		rbrace := expr.LastTok()
+		c.errs = errors.Join(c.errs, diag.At(diag.SpanOf(rbrace, rbrace), "missing return in function returning `%s`", ret))
+	}
+
+	return signature
+}
+
+// quietly runs f without reporting errors or recording definitions. It is for looking at the signature
+// of a function ahead of time, whose mistakes are reported when the function itself is checked.
+func (c *Checker) quietly(f func()) {
+	errs, info := c.errs, c.Info
+	c.Info = nil
+	f()
+	c.errs, c.Info = errs, info
+}
+
+func (c *Checker) funcSignature(currScope *Scope, expr ast.FuncDef) TypeName {
+	outer := c.typeParams
+	c.typeParams = c.funcTypeParams(expr, true)
+	defer func() { c.typeParams = outer }()
+	typeParams := []string{}
+	for _, typeParam := range expr.TypeParams {
+		typeParams = append(typeParams, typeParam.Name.Name)
+	}
+	params := []TypeName{}
+	for _, arg := range expr.Args {
+		params = append(params, c.TypeName(currScope, arg.Type))
+	}
+	ret := TypeName{Name: "nil"}
+	if expr.ReturnType != nil {
+		ret = c.TypeName(currScope, *expr.ReturnType)
+	}
+	signature := FuncType(params, ret)
+	if len(typeParams) > 0 {
+		signature.Params = typeParams
+	}
+	return signature
+}
+
+// funcTypeParams adds the type parameters of a generic function to the ones in scope.
+func (c *Checker) funcTypeParams(expr ast.FuncDef, report bool) map[string]bool {
+	typeParams := make(map[string]bool)
+	for name := range c.typeParams {
+		typeParams[name] = true
+	}
+	own := make(map[string]bool)
+	for _, typeParam := range expr.TypeParams {
+		name := typeParam.Name.Name
+		if report && len(typeParam.Vars) > 0 {
+			c.errorf(typeParam, "type parameter `%s` cannot have type parameters", name)
+		}
+		if report && own[name] {
+			c.errorf(typeParam, "duplicate type parameter `%s`", name)
+		}
+		own[name] = true
+		typeParams[name] = true
+	}
+	return typeParams
+}
+
+// terminates reports whether stmts always end in a `return`, so that they can't fall off their end.
+func terminates(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case ast.ReturnStmt:
+			return true
+		case ast.IfStmt:
+			if stmt.Else != nil && terminates(stmt.Then.Stmts) && terminates(stmt.Else.Stmts) {
+				return true
+			}
+		case ast.WhileStmt:
+			// `while true` only ends through a return, unless it has a `break`
+			if cond, isLiteral := stmt.Cond.(ast.Literal); isLiteral && cond.Token.Type() == token.TRUE && !breaks(stmt.Body.Stmts) {
+				return true
+			}
+		case ast.MatchStmt:
+			// the arms cover every alternative, or the match is already an error
+			all := len(stmt.Arms) > 0
+			for _, arm := range stmt.Arms {
+				all = all && terminates(arm.Body.Stmts)
+			}
+			if all {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// breaks reports whether stmts have a `break` of the loop they are the body of, outside of any loop inside it.
+func breaks(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case ast.BreakStmt:
+			return true
+		case ast.IfStmt:
+			if breaks(stmt.Then.Stmts) || (stmt.Else != nil && breaks(stmt.Else.Stmts)) {
+				return true
+			}
+		case ast.MatchStmt:
+			for _, arm := range stmt.Arms {
+				if breaks(arm.Body.Stmts) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isPrimitive(name string) bool {
+	return builtin.IsPrimitive(name)
+}
+
+// assignable reports whether a value of type got can be stored where want is expected.
+// Any alternative of an either can be stored in it.
+func assignable(want, got TypeName) bool {
+	if sameType(want, got) {
+		return true
+	}
+	if !want.IsEither() {
+		return false
+	}
+	if got.IsEither() {
+		for _, alt := range got.Vars {
+			if !assignable(want, alt) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, alt := range want.Vars {
+		if assignable(alt, got) {
+			return true
+		}
+	}
+	return false
+}
+
+// canHold reports whether a value of type ty can be found in a value of type holder,
+// unwrapping eithers as `match` and `is` do.
+func canHold(holder, ty TypeName) bool {
+	if sameType(holder, ty) {
+		return true
+	}
+	if holder.IsEither() {
+		for _, alt := range holder.Vars {
+			if canHold(alt, ty) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// covered reports whether match arms for the types in arms handle every value of type ty.
+func covered(ty TypeName, arms []TypeName) bool {
+	for _, arm := range arms {
+		if sameType(ty, arm) {
+			return true
+		}
+	}
+	if !ty.IsEither() {
+		return false
+	}
+	for _, alt := range ty.Vars {
+		if !covered(alt, arms) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameType(a, b TypeName) bool {
+	if a.Name == unknown.Name || b.Name == unknown.Name {
+		return true
+	}
+	if a.Name != b.Name || len(a.Vars) != len(b.Vars) {
+		return false
+	}
+	for i := range a.Vars {
+		if !sameType(a.Vars[i], b.Vars[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package check
+
+import (
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/trees/ast"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Info records what the checker found out about the names in the code, for tools like the language server.
+// The checker only fills it in when Checker.Info is set.
+type Info struct {
+	Defs   []*Def
+	Uses   []Use
+	Scopes map[*Scope]diag.Span // the source each scope covers; the base scope covers everything
+	byName map[*Scope]map[string]*Def
+}
+
+// Def is a variable or a type, and where it was defined.
+type Def struct {
+	Ident  ast.Ident
+	Type   TypeName // the type of a variable
+	Struct *Type    // the definition of a type, nil for variables
+	Scope  *Scope
+}
+
+func (d Def) IsType() bool { return d.Struct != nil }
+
+// Use is an identifier that refers to a definition.
+type Use struct {
+	Ident ast.Ident
+	Def   *Def
+}
+
+func NewInfo() *Info {
+	return &Info{Scopes: make(map[*Scope]diag.Span), byName: make(map[*Scope]map[string]*Def)}
+}
+
+// key separates the names of types from the names of variables.
+func key(name string, isType bool) string {
+	if isType {
+		return "type " + name
+	}
+	return name
+}
+
+func (c *Checker) scopeSpan(scope *Scope, node ast.HasTokens) {
+	if c.Info != nil {
+		c.Info.Scopes[scope] = diag.NodeSpan(node)
+	}
+}
+
+func (c *Checker) define(scope *Scope, ident ast.Ident, ty TypeName, st *Type) *Def {
+	if c.Info == nil {
+		return nil
+	}
+	def := &Def{Ident: ident, Type: ty, Struct: st, Scope: scope}
+	c.Info.Defs = append(c.Info.Defs, def)
+	if c.Info.byName[scope] == nil {
+		c.Info.byName[scope] = make(map[string]*Def)
+	}
+	c.Info.byName[scope][key(ident.Name, st != nil)] = def
+	return def
+}
+
+func (c *Checker) use(scope *Scope, ident ast.Ident, isType bool) {
+	if c.Info == nil {
+		return
+	}
+	for s := scope; s != nil; s = s.Parent {
+		if def, ok := c.Info.byName[s][key(ident.Name, isType)]; ok {
+			c.Info.Uses = append(c.Info.Uses, Use{Ident: ident, Def: def})
+			return
+		}
+	}
+}
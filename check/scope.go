@@ -0,0 +1,77 @@
+package check
+
+import (
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Scope is the static counterpart of env.Env: it maps names to types instead of values.
+type Scope struct {
+	Parent    *Scope
+	Types     map[string]Type
+	Variables map[string]TypeName
+	hoisted   map[string]bool // functions declared ahead of their `let`, so that they can call each other
+	isFunc    bool            // whether this is the scope of a function body
+}
+
+func NewScope() Scope {
+	return Scope{
+		Parent:    nil,
+		Types:     make(map[string]Type),
+		Variables: make(map[string]TypeName),
+	}
+}
+
+func (s *Scope) MakeChild() Scope {
+	return Scope{
+		Parent:    s,
+		Types:     make(map[string]Type),
+		Variables: make(map[string]TypeName),
+	}
+}
+
+// hoist declares a function before its `let` is reached.
+func (s *Scope) hoist(name string, signature TypeName) {
+	if s.hoisted == nil {
+		s.hoisted = make(map[string]bool)
+	}
+	s.hoisted[name] = true
+	s.Variables[name] = signature
+}
+
+func (s *Scope) DefineType(typeName string, structType Type) {
+	s.Types[typeName] = structType
+}
+
+// DefineMethod adds a method to the type typeName, in the scope the type is defined in.
+// It reports false if there is no such type.
+func (s *Scope) DefineMethod(typeName, name string, method Method) bool {
+	if t, ok := s.Types[typeName]; ok {
+		s.Types[typeName] = t.WithMethod(name, method)
+		return true
+	} else if s.Parent != nil {
+		return s.Parent.DefineMethod(typeName, name, method)
+	}
+	return false
+}
+func (s Scope) GetType(typeName string) *Type {
+	if t, ok := s.Types[typeName]; ok {
+		return &t
+	} else if s.Parent != nil {
+		return s.Parent.GetType(typeName)
+	} else {
+		return nil
+	}
+}
+
+func (s *Scope) DefineVariable(name string, typeName TypeName) {
+	s.Variables[name] = typeName
+}
+func (s Scope) GetVariable(name string) *TypeName {
+	if t, ok := s.Variables[name]; ok {
+		return &t
+	} else if s.Parent != nil {
+		return s.Parent.GetVariable(name)
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,635 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/ast"
+	"github.com/bigyihsuan/structlang/util"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Compiler lowers the AST into a Program for the vm.
+// Every env the evaluator would create is mirrored by a scope, so variables resolve to
+// a number of envs up and a slot in that env instead of a name.
+type Compiler struct {
+	Code  []ast.Stmt
+	prog  *Program
+	fn    *Function
+	scope *scope
+	names map[string]int
+	node  ast.HasTokens // the innermost node being compiled, whose span emitted instructions get
+	loops []*loop       // the loops around the statement being compiled in the current function, innermost last
+}
+
+// loop is where `break` and `continue` go to.
+type loop struct {
+	top    int   // where `continue` jumps to
+	blocks int   // the blocks entered since the loop began, which `break` and `continue` leave
+	breaks []int // the jumps past the end of the loop, which are patched once it is compiled
+}
+
+type scope struct {
+	parent   *scope
+	slots    map[string]int
+	numSlots int
+}
+
+func (s *scope) declare(name string) int {
+	if slot, ok := s.slots[name]; ok {
+		return slot
+	}
+	s.slots[name] = s.numSlots
+	s.numSlots++
+	return s.slots[name]
+}
+
+func NewCompiler(code []ast.Stmt) Compiler {
+	return Compiler{Code: code}
+}
+
+func (c *Compiler) Compile() (*Program, error) {
+	c.prog = &Program{Main: &Function{}}
+	c.fn = c.prog.Main
+	c.scope = &scope{slots: make(map[string]int)}
+	c.names = make(map[string]int)
+
+	var errs error
+	c.hoist(c.Code)
+	for _, stmt := range c.Code {
+		c.prog.Stmts = append(c.prog.Stmts, len(c.fn.Code))
+		if err := c.Stmt(stmt); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	c.prog.Main.NumSlots = c.scope.numSlots
+	return c.prog, errs
+}
+
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	instr := Instr{Op: op}
+	for i, operand := range operands {
+		switch i {
+		case 0:
+			instr.A = operand
+		case 1:
+			instr.B = operand
+		case 2:
+			instr.C = operand
+		}
+	}
+	c.fn.Code = append(c.fn.Code, instr)
+	c.fn.Spans = append(c.fn.Spans, diag.NodeSpan(c.node))
+	return len(c.fn.Code) - 1
+}
+
+// patch points the jump at pc to the next instruction.
+func (c *Compiler) patch(pc int) {
+	c.fn.Code[pc].A = len(c.fn.Code)
+}
+
+func (c *Compiler) name(name string) int {
+	if idx, ok := c.names[name]; ok {
+		return idx
+	}
+	c.prog.Names = append(c.prog.Names, name)
+	c.names[name] = len(c.prog.Names) - 1
+	return c.names[name]
+}
+
+func (c *Compiler) constant(v Value) int {
+	c.prog.Consts = append(c.prog.Consts, v)
+	return len(c.prog.Consts) - 1
+}
+
+func (c *Compiler) typeName(t ast.Type) int {
+	c.prog.Types = append(c.prog.Types, toTypeName(t))
+	return len(c.prog.Types) - 1
+}
+
+// resolve finds the env and slot a variable lives in, which is the innermost one declared so far,
+// like the evaluator finds it. Functions are declared before their block is compiled,
+// so names that still aren't declared are assumed to be globals defined later:
+// the top level is the only place where a function can use a variable defined after it.
+func (c *Compiler) resolve(name string) (depth, slot int) {
+	s := c.scope
+	for ; s.parent != nil; s = s.parent {
+		if slot, ok := s.slots[name]; ok {
+			return depth, slot
+		}
+		depth++
+	}
+	return depth, s.declare(name)
+}
+
+// block compiles stmts in a child env. prelude runs first, inside the child env.
+func (c *Compiler) block(stmts []ast.Stmt, prelude func()) error {
+	enter := c.emit(OpEnterBlock, 0)
+	c.scope = &scope{parent: c.scope, slots: make(map[string]int)}
+	if len(c.loops) > 0 {
+		c.loops[len(c.loops)-1].blocks++
+		defer func() { c.loops[len(c.loops)-1].blocks-- }()
+	}
+	if prelude != nil {
+		prelude()
+	}
+	err := c.Stmts(stmts)
+	c.fn.Code[enter].A = c.scope.numSlots
+	c.scope = c.scope.parent
+	c.emit(OpLeaveBlock)
+	return err
+}
+
+// hoist declares the functions defined in stmts before any of them is compiled,
+// so that functions in the same block can call each other.
+func (c *Compiler) hoist(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		if varDef, isVarDef := stmt.(ast.VarDef); isVarDef {
+			if _, isFunc := varDef.Rvalue.(ast.FuncDef); isFunc {
+				c.scope.declare(rootName(varDef.Lvalue))
+			}
+		}
+	}
+}
+
+func (c *Compiler) Stmts(stmts []ast.Stmt) error {
+	c.hoist(stmts)
+	var errs error
+	for _, stmt := range stmts {
+		if err := c.Stmt(stmt); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
+
+// at sets the node whose span is given to emitted instructions,
+// and returns the previous one so that it can be restored.
+func (c *Compiler) at(node ast.HasTokens) ast.HasTokens {
+	prev := c.node
+	c.node = node
+	return prev
+}
+
+func (c *Compiler) Stmt(stmt ast.Stmt) error {
+	defer c.at(c.at(stmt))
+	switch stmt := stmt.(type) {
+	case ast.TypeDef:
+		td := TypeDef{Name: stmt.Type.Name.Name, Type: toType(stmt.StructDef)}
+		if stmt.Alias != nil {
+			alias := toTypeName(*stmt.Alias)
+			td.Type = Type{Fields: make(map[string]TypeName), Vars: toTypeName(stmt.Type).Vars, Alias: &alias}
+		}
+		c.prog.TypeDefs = append(c.prog.TypeDefs, td)
+		c.emit(OpTypeDef, len(c.prog.TypeDefs)-1)
+		return nil
+	case ast.VarDef:
+		return c.VarDef(stmt)
+	case ast.VarSet:
+		return c.VarSet(stmt)
+	case ast.ExprStmt:
+		if err := c.Expr(stmt.Expr); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+		return nil
+	case ast.ReturnStmt:
+		if stmt.Expr != nil {
+			if err := c.Expr(stmt.Expr); err != nil {
+				return err
+			}
+		} else {
+			c.emit(OpConst, c.constant(builtin.NewNil()))
+		}
+		c.emit(OpReturn)
+		return nil
+	case ast.IfStmt:
+		return c.IfStmt(stmt)
+	case ast.WhileStmt:
+		return c.WhileStmt(stmt)
+	case ast.ForStmt:
+		return c.ForStmt(stmt)
+	case ast.BreakStmt, ast.ContinueStmt:
+		return c.jump(stmt)
+	case ast.MatchStmt:
+		return c.MatchStmt(stmt)
+	case ast.MethodDef:
+		if err := c.FuncDef(stmt.Func); err != nil {
+			return err
+		}
+		c.emit(OpMethod, c.name(stmt.Receiver.Type.Name.Name), c.name(stmt.Name.Name))
+		return nil
+	default:
+		return fmt.Errorf("compile unknown stmt: %T", stmt)
+	}
+}
+
+func (c *Compiler) VarDef(stmt ast.VarDef) error {
+	name := rootName(stmt.Lvalue)
+	if err := c.Expr(stmt.Rvalue); err != nil {
+		return err
+	}
+	c.emit(OpDefine, c.scope.declare(name))
+	return nil
+}
+
+func (c *Compiler) VarSet(stmt ast.VarSet) error {
+	name := rootName(stmt.Lvalue)
+	if err := c.Expr(stmt.Rvalue); err != nil {
+		return err
+	}
+	if fa, isField := stmt.Lvalue.(ast.FieldAccess); isField {
+		// load the struct holding the field, which is updated in place
+		if err := c.Expr(fa.Lvalue); err != nil {
+			return err
+		}
+		c.emit(OpSetField, c.name(fa.Field.Name))
+		return nil
+	}
+	if index, isIndex := stmt.Lvalue.(ast.Index); isIndex {
+		// and so is the list holding the element
+		if err := c.Expr(index.Lvalue); err != nil {
+			return err
+		}
+		if err := c.Expr(index.Index); err != nil {
+			return err
+		}
+		c.emit(OpSetIndex)
+		return nil
+	}
+	depth, slot := c.resolve(name)
+	c.emit(OpStore, depth, slot, c.name(name))
+	return nil
+}
+
+func rootName(lvalue ast.Lvalue) string {
+	switch lvalue := lvalue.(type) {
+	case ast.FieldAccess:
+		return rootName(lvalue.Lvalue)
+	case ast.Index:
+		return rootName(lvalue.Lvalue)
+	case ast.Ident:
+		return lvalue.Name
+	}
+	return ""
+}
+
+func (c *Compiler) IfStmt(stmt ast.IfStmt) error {
+	toElse, err := c.Cond(stmt.Cond)
+	if err != nil {
+		return err
+	}
+	if err := c.block(stmt.Then.Stmts, nil); err != nil {
+		return err
+	}
+	if stmt.Else == nil {
+		c.patch(toElse)
+		return nil
+	}
+	toEnd := c.emit(OpJump, 0)
+	c.patch(toElse)
+	if err := c.block(stmt.Else.Stmts, nil); err != nil {
+		return err
+	}
+	c.patch(toEnd)
+	return nil
+}
+
+func (c *Compiler) WhileStmt(stmt ast.WhileStmt) error {
+	top := len(c.fn.Code)
+	toEnd, err := c.Cond(stmt.Cond)
+	if err != nil {
+		return err
+	}
+	l := c.enterLoop(top)
+	err = c.block(stmt.Body.Stmts, nil)
+	c.emit(OpJump, top)
+	c.leaveLoop(l)
+	c.patch(toEnd)
+	return err
+}
+
+// ForStmt keeps the iterator on the stack while the loop runs.
+// Every element is bound to its names in the scope of the body, like the value of a match arm.
+func (c *Compiler) ForStmt(stmt ast.ForStmt) error {
+	if err := c.Expr(stmt.Iterable); err != nil {
+		return err
+	}
+	if stmt.End != nil {
+		if err := c.Expr(stmt.End); err != nil {
+			return err
+		}
+		c.emit(OpRange)
+	} else if stmt.Index != nil {
+		c.emit(OpIter, 1)
+	} else {
+		c.emit(OpIter, 0)
+	}
+	top := c.emit(OpNext, 0)
+	l := c.enterLoop(top)
+	err := c.block(stmt.Body.Stmts, func() {
+		c.emit(OpDefine, c.scope.declare(stmt.Elem.Name))
+		if stmt.Index != nil {
+			c.emit(OpDefine, c.scope.declare(stmt.Index.Name))
+		} else {
+			c.emit(OpPop)
+		}
+	})
+	c.emit(OpJump, top)
+	c.leaveLoop(l)
+	c.patch(top)
+	c.emit(OpPop)
+	return err
+}
+
+func (c *Compiler) enterLoop(top int) *loop {
+	l := &loop{top: top}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+// leaveLoop ends the innermost loop, whose `break`s jump to the next instruction.
+func (c *Compiler) leaveLoop(l *loop) {
+	c.loops = c.loops[:len(c.loops)-1]
+	for _, pc := range l.breaks {
+		c.patch(pc)
+	}
+}
+
+// jump compiles `break` or `continue`, which leave the blocks inside the innermost loop before jumping.
+func (c *Compiler) jump(stmt ast.Stmt) error {
+	if len(c.loops) == 0 {
+		// an error once it runs, like in the evaluator
+		c.emit(OpFail, c.name(fmt.Sprintf("`%s` outside of a loop", stmt.FirstTok().Lexeme())))
+		return nil
+	}
+	l := c.loops[len(c.loops)-1]
+	for i := 0; i < l.blocks; i++ {
+		c.emit(OpLeaveBlock)
+	}
+	if _, isBreak := stmt.(ast.BreakStmt); isBreak {
+		l.breaks = append(l.breaks, c.emit(OpJump, 0))
+	} else {
+		c.emit(OpJump, l.top)
+	}
+	return nil
+}
+
+func (c *Compiler) MatchStmt(stmt ast.MatchStmt) error {
+	if err := c.Expr(stmt.Subject); err != nil {
+		return err
+	}
+	toEnd := []int{}
+	for _, arm := range stmt.Arms {
+		toNext := c.emit(OpMatchArm, c.typeName(arm.Type), 0)
+		err := c.block(arm.Body.Stmts, func() {
+			if arm.Binding != nil {
+				c.emit(OpDefine, c.scope.declare(arm.Binding.Name))
+			} else {
+				c.emit(OpPop)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		toEnd = append(toEnd, c.emit(OpJump, 0))
+		c.fn.Code[toNext].B = len(c.fn.Code)
+	}
+	c.emit(OpNoMatch)
+	for _, pc := range toEnd {
+		c.patch(pc)
+	}
+	return nil
+}
+
+// Cond compiles a condition and a jump past whatever it guards, which is to be patched.
+func (c *Compiler) Cond(expr ast.Expr) (int, error) {
+	if err := c.Expr(expr); err != nil {
+		return 0, err
+	}
+	defer c.at(c.at(expr))
+	return c.emit(OpJumpIfFalse, 0), nil
+}
+
+func (c *Compiler) Expr(expr ast.Expr) error {
+	defer c.at(c.at(expr))
+	switch expr := expr.(type) {
+	case ast.Literal:
+		return c.Literal(expr)
+	case ast.Ident:
+		depth, slot := c.resolve(expr.Name)
+		c.emit(OpLoad, depth, slot, c.name(expr.Name))
+		return nil
+	case ast.StructLiteral:
+		literal := StructLiteral{Type: toTypeName(expr.TypeName)}
+		for _, field := range expr.Fields {
+			if err := c.Expr(field.Value); err != nil {
+				return err
+			}
+			literal.Fields = append(literal.Fields, field.Name.Name)
+		}
+		c.prog.Literals = append(c.prog.Literals, literal)
+		c.emit(OpStruct, len(c.prog.Literals)-1)
+		return nil
+	case ast.ListLiteral:
+		for _, elem := range expr.Elems {
+			if err := c.Expr(elem); err != nil {
+				return err
+			}
+		}
+		c.emit(OpList, len(expr.Elems), c.typeName(expr.TypeName))
+		return nil
+	case ast.MapLiteral:
+		for _, entry := range expr.Entries {
+			if err := c.Expr(entry.Key); err != nil {
+				return err
+			}
+			if err := c.Expr(entry.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(OpMap, len(expr.Entries), c.typeName(expr.TypeName))
+		return nil
+	case ast.FieldAccess:
+		if err := c.Expr(expr.Lvalue); err != nil {
+			return err
+		}
+		c.emit(OpField, c.name(expr.Field.Name))
+		return nil
+	case ast.Index:
+		if err := c.Expr(expr.Lvalue); err != nil {
+			return err
+		}
+		if err := c.Expr(expr.Index); err != nil {
+			return err
+		}
+		c.emit(OpIndex)
+		return nil
+	case ast.PrefixExpr:
+		if err := c.Expr(expr.Right); err != nil {
+			return err
+		}
+		c.emit(OpPrefix, int(expr.Op.Type()))
+		return nil
+	case ast.InfixExpr:
+		if err := c.Expr(expr.Left); err != nil {
+			return err
+		}
+		if err := c.Expr(expr.Right); err != nil {
+			return err
+		}
+		c.emit(OpInfix, int(expr.Op.Type()))
+		return nil
+	case ast.GroupingExpr:
+		return c.Expr(expr.Expr)
+	case ast.FuncCallExpr:
+		return c.FuncCallExpr(expr)
+	case ast.FuncDef:
+		return c.FuncDef(expr)
+	case ast.Instantiation:
+		if err := c.Expr(expr.Name); err != nil {
+			return err
+		}
+		c.instantiate(expr.TypeArgs)
+		return nil
+	case ast.IsExpr:
+		if err := c.Expr(expr.Left); err != nil {
+			return err
+		}
+		c.emit(OpIs, c.typeName(expr.Type))
+		return nil
+	default:
+		return fmt.Errorf("compile unknown expr: %T", expr)
+	}
+}
+
+func (c *Compiler) Literal(expr ast.Literal) error {
+	var v Value
+	switch expr.Token.Type() {
+	case token.INT:
+		i, err := strconv.Atoi(expr.Token.Lexeme())
+		if err != nil {
+			return err
+		}
+		v = builtin.NewInt(i)
+	case token.FLOAT:
+		f, err := strconv.ParseFloat(expr.Token.Lexeme(), 64)
+		if err != nil {
+			return err
+		}
+		v = builtin.NewFloat(f)
+	case token.TRUE, token.FALSE:
+		b, err := strconv.ParseBool(expr.Token.Lexeme())
+		if err != nil {
+			return err
+		}
+		v = builtin.NewBool(b)
+	case token.STRING:
+		v = builtin.NewString(expr.Token.Lexeme())
+	case token.NIL:
+		v = builtin.NewNil()
+	default:
+		return fmt.Errorf("compile unknown literal %s", expr.Token.Type().String())
+	}
+	c.emit(OpConst, c.constant(v))
+	return nil
+}
+
+func (c *Compiler) FuncCallExpr(expr ast.FuncCallExpr) error {
+	for _, arg := range expr.Args {
+		if err := c.Expr(arg); err != nil {
+			return err
+		}
+	}
+	if fa, isFieldAccess := expr.Name.(ast.FieldAccess); isFieldAccess {
+		if err := c.Expr(fa.Lvalue); err != nil {
+			return err
+		}
+		c.emit(OpCallMethod, len(expr.Args), c.name(fa.Field.Name))
+		return nil
+	}
+	if ident, isIdent := expr.Name.(ast.Ident); isIdent {
+		if _, isBuiltin := builtin.BuiltinFuncs()[ident.Name]; isBuiltin {
+			c.emit(OpCallBuiltin, c.name(ident.Name), len(expr.Args))
+			return nil
+		}
+	}
+	if err := c.Expr(expr.Name); err != nil {
+		return err
+	}
+	if len(expr.TypeArgs) > 0 {
+		c.instantiate(expr.TypeArgs)
+	}
+	c.emit(OpCall, len(expr.Args))
+	return nil
+}
+
+func (c *Compiler) instantiate(typeArgs []ast.Type) {
+	first := len(c.prog.Types)
+	for _, typeArg := range typeArgs {
+		c.typeName(typeArg)
+	}
+	c.emit(OpInstantiate, first, len(typeArgs))
+}
+
+func (c *Compiler) FuncDef(expr ast.FuncDef) error {
+	fn := &Function{}
+	for _, typeParam := range expr.TypeParams {
+		fn.TypeParams = append(fn.TypeParams, typeParam.Name.Name)
+	}
+	funcScope := &scope{parent: c.scope, slots: make(map[string]int)}
+	for _, arg := range expr.Args {
+		fn.Args = append(fn.Args, util.Pair[string, TypeName]{First: arg.Name.Name, Last: toTypeName(arg.Type)})
+		funcScope.declare(arg.Name.Name)
+	}
+	fn.Ret = builtin.NewNil().TypeName()
+	if expr.ReturnType != nil {
+		fn.Ret = toTypeName(*expr.ReturnType)
+	}
+
+	outerFn, outerScope, outerLoops := c.fn, c.scope, c.loops
+	c.fn, c.scope, c.loops = fn, funcScope, nil
+	err := c.Stmts(expr.Body)
+	// falling off the end returns nil
+	c.emit(OpConst, c.constant(builtin.NewNil()))
+	c.emit(OpReturn, 1)
+	fn.NumSlots = funcScope.numSlots
+	c.fn, c.scope, c.loops = outerFn, outerScope, outerLoops
+	if err != nil {
+		return err
+	}
+
+	c.prog.Functions = append(c.prog.Functions, fn)
+	c.emit(OpClosure, len(c.prog.Functions)-1)
+	return nil
+}
+
+// toTypeName converts a type written in the source into a TypeName.
+func toTypeName(t ast.Type) TypeName {
+	vars := []TypeName{}
+	for _, v := range t.Vars {
+		vars = append(vars, toTypeName(v))
+	}
+	return TypeName{Name: t.Name.Name, Vars: vars}
+}
+
+func toType(structDef ast.StructDef) Type {
+	st := Type{Fields: make(map[string]TypeName), Vars: []TypeName{}}
+	for _, field := range structDef.Fields {
+		if field.IsEmbedded() {
+			st.Fields[field.Type.Name.Name] = toTypeName(field.Type)
+			st.Embedded = append(st.Embedded, field.Type.Name.Name)
+		}
+		for _, name := range field.Names {
+			st.Fields[name.Name] = toTypeName(field.Type)
+		}
+	}
+	for _, v := range structDef.Vars {
+		st.Vars = append(st.Vars, toTypeName(v))
+	}
+	return st
+}
@@ -0,0 +1,144 @@
+package compile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/util"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+type Opcode byte
+
+const (
+	OpConst       Opcode = iota // push Consts[A]
+	OpPop                       // discard the top of the stack
+	OpLoad                      // push slot B of the env A levels up; Names[C] is the variable
+	OpDefine                    // pop into slot A of the current env
+	OpStore                     // pop into the defined slot B of the env A levels up; Names[C] is the variable
+	OpField                     // pop a value, push its field Names[A]
+	OpSetField                  // pop a struct and then a value, store the value in the struct's field Names[A]
+	OpIndex                     // pop an index and a list, push the element at the index
+	OpSetIndex                  // pop an index, a list and then a value, store the value in the list's element at the index
+	OpPrefix                    // pop a value, push the prefix operator token.TokenType(A) applied to it
+	OpInfix                     // pop two values, push the infix operator token.TokenType(A) applied to them
+	OpIs                        // pop a value, push whether it holds a Types[A]
+	OpStruct                    // pop the fields of Literals[A], push the struct
+	OpList                      // pop A elements, push the list of type Types[B]
+	OpMap                       // pop A keys each followed by its value, push the map of type Types[B]
+	OpTypeDef                   // define TypeDefs[A] in the current env
+	OpClosure                   // push Functions[A] closed over the current env
+	OpCall                      // pop a function and A arguments, push its return value
+	OpCallBuiltin               // pop B arguments, push the return value of the builtin Names[A]
+	OpCallMethod                // pop a receiver and A arguments, call its method Names[B], or else the function in its field Names[B]
+	OpMethod                    // pop a function, add it to the type Names[A] as the method Names[B]
+	OpInstantiate               // pop a generic function, push it with its type parameters filled in by the B types from Types[A]
+	OpReturn                    // pop the return value and leave the function; A is 1 if the body ran off its end
+	OpJump                      // jump to A
+	OpJumpIfFalse               // pop a bool, jump to A if it is false
+	OpEnterBlock                // push a child env with A slots
+	OpLeaveBlock                // pop the current env
+	OpMatchArm                  // if the top of the stack holds a Types[A], replace it with the held value, otherwise jump to B
+	OpNoMatch                   // pop the match subject and fail
+	OpFail                      // fail with the message Names[A]
+	OpIter                      // pop a value, push an iterator over it; A is 1 if the loop names the position of each element
+	OpRange                     // pop the end and then the start of a range, push an iterator over it
+	OpNext                      // push the position and the next element of the iterator on top of the stack, or jump to A once it is done
+)
+
+var opNames = [...]string{
+	OpConst:       "CONST",
+	OpPop:         "POP",
+	OpLoad:        "LOAD",
+	OpDefine:      "DEFINE",
+	OpStore:       "STORE",
+	OpField:       "FIELD",
+	OpSetField:    "SETFIELD",
+	OpIndex:       "INDEX",
+	OpSetIndex:    "SETINDEX",
+	OpPrefix:      "PREFIX",
+	OpInfix:       "INFIX",
+	OpIs:          "IS",
+	OpStruct:      "STRUCT",
+	OpList:        "LIST",
+	OpMap:         "MAP",
+	OpTypeDef:     "TYPEDEF",
+	OpClosure:     "CLOSURE",
+	OpCall:        "CALL",
+	OpCallBuiltin: "CALLBUILTIN",
+	OpCallMethod:  "CALLMETHOD",
+	OpMethod:      "METHOD",
+	OpInstantiate: "INSTANTIATE",
+	OpReturn:      "RETURN",
+	OpJump:        "JUMP",
+	OpJumpIfFalse: "JUMPIFFALSE",
+	OpEnterBlock:  "ENTERBLOCK",
+	OpLeaveBlock:  "LEAVEBLOCK",
+	OpMatchArm:    "MATCHARM",
+	OpNoMatch:     "NOMATCH",
+	OpFail:        "FAIL",
+	OpIter:        "ITER",
+	OpRange:       "RANGE",
+	OpNext:        "NEXT",
+}
+
+func (op Opcode) String() string { return opNames[op] }
+
+type Instr struct {
+	Op      Opcode
+	A, B, C int
+}
+
+func (i Instr) String() string {
+	return fmt.Sprintf("%-12s %d %d %d", i.Op, i.A, i.B, i.C)
+}
+
+// Function is a compiled func literal.
+// Its env holds the arguments in the first slots, followed by the locals of its body.
+type Function struct {
+	TypeParams []string
+	Args       []util.Pair[string, TypeName]
+	Ret        TypeName // the declared return type, `nil` if there is none
+	NumSlots   int
+	Code       []Instr
+	Spans      []diag.Span // the source of each instruction in Code
+}
+
+type StructLiteral struct {
+	Type   TypeName
+	Fields []string // in the order their values are pushed
+}
+
+type TypeDef struct {
+	Name string
+	Type Type
+}
+
+// Program is the output of the compiler: the top-level code and the tables its instructions index into.
+type Program struct {
+	Main      *Function
+	Functions []*Function
+	Consts    []Value
+	Names     []string
+	Types     []TypeName
+	Literals  []StructLiteral
+	TypeDefs  []TypeDef
+	Stmts     []int // the first instruction of every top-level statement in Main
+}
+
+func (p Program) String() string {
+	var sb strings.Builder
+	disassemble(&sb, "main", p.Main)
+	for i, fn := range p.Functions {
+		disassemble(&sb, fmt.Sprintf("func %d", i), fn)
+	}
+	return sb.String()
+}
+
+func disassemble(sb *strings.Builder, name string, fn *Function) {
+	fmt.Fprintf(sb, "%s (%d slots):\n", name, fn.NumSlots)
+	for pc, instr := range fn.Code {
+		fmt.Fprintf(sb, "%4d %s\n", pc, instr)
+	}
+}
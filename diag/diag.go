@@ -0,0 +1,164 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	gotoken "go/token"
+
+	"github.com/bigyihsuan/structlang/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Node is anything that knows the tokens it was parsed from, like ast.HasTokens.
+type Node interface {
+	FirstTok() *token.Token
+	LastTok() *token.Token
+}
+
+// Span is the source range between the start of its first token and the end of its last token.
+type Span struct {
+	Start, End gotoken.Position
+}
+
+func (s Span) IsValid() bool { return s.Start.IsValid() }
+
+// SpanOf returns the span from first to last. Either may be nil.
+func SpanOf(first, last *token.Token) (s Span) {
+	if first == nil {
+		first = last
+	}
+	if last == nil {
+		last = first
+	}
+	if first == nil {
+		return s
+	}
+	s.Start = first.Position()
+	s.End = last.Position()
+	width, columns := len(last.Lexeme()), len([]rune(last.Lexeme()))
+	if last.Type() == token.STRING {
+		// the lexeme leaves out the quotes
+		width, columns = width+2, columns+2
+	}
+	s.End.Offset += width
+	s.End.Column += columns
+	return s
+}
+
+// NodeSpan returns the span of node, or the zero Span if it has no tokens.
+func NodeSpan(node Node) Span {
+	if node == nil {
+		return Span{}
+	}
+	return SpanOf(node.FirstTok(), node.LastTok())
+}
+
+// Diagnostic is an error tied to a span of source code.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Span     Span
+	Notes    []string
+	Cause    error // the error this diagnostic was made from, if any
+}
+
+func Errorf(node Node, format string, args ...any) Diagnostic {
+	return At(NodeSpan(node), format, args...)
+}
+
+func At(span Span, format string, args ...any) Diagnostic {
+	return Diagnostic{Severity: Error, Message: fmt.Sprintf(format, args...), Span: span}
+}
+
+func (d Diagnostic) WithNote(format string, args ...any) Diagnostic {
+	d.Notes = append(append([]string{}, d.Notes...), fmt.Sprintf(format, args...))
+	return d
+}
+
+func (d Diagnostic) Error() string {
+	if !d.Span.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%v: %s: %s", d.Span.Start, d.Severity, d.Message)
+}
+
+func (d Diagnostic) Unwrap() error { return d.Cause }
+
+// Wrap gives err the span of node, unless err already has a span.
+// Errors joined with errors.Join are wrapped one by one.
+func Wrap(node Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	if d, isDiag := err.(Diagnostic); isDiag {
+		return d
+	}
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, Wrap(node, e))
+		}
+		return errors.Join(errs...)
+	}
+	d := Errorf(node, "%s", err)
+	d.Cause = err
+	return d
+}
+
+// FromChain turns a chain of context errors, like the parser's `errors.Join(errors.New("in stmt"), err)`,
+// into one diagnostic. The innermost Diagnostic in the chain is the primary message,
+// and the rest of the chain becomes its notes, innermost first.
+// If the chain holds no Diagnostic, its last message is placed at fallback.
+func FromChain(err error, fallback Span) Diagnostic {
+	var msgs []string
+	var primary *Diagnostic
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case Diagnostic:
+			if primary == nil {
+				primary = &e
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		default:
+			msgs = append(msgs, err.Error())
+		}
+	}
+	walk(err)
+
+	var d Diagnostic
+	if primary != nil {
+		d = *primary
+	} else if len(msgs) > 0 {
+		d = At(fallback, "%s", msgs[len(msgs)-1])
+		msgs = msgs[:len(msgs)-1]
+	} else {
+		d = At(fallback, "%s", err)
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		d = d.WithNote("%s", msgs[i])
+	}
+	d.Cause = err
+	return d
+}
@@ -0,0 +1,71 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Render writes every error in err, one after the other.
+// Diagnostics are printed with the source line they point at and a caret underline;
+// any other error is printed as is.
+func Render(w io.Writer, src string, err error) {
+	lines := strings.Split(src, "\n")
+	for _, e := range Flatten(err) {
+		if d, isDiag := e.(Diagnostic); isDiag {
+			d.render(w, lines)
+		} else {
+			fmt.Fprintln(w, e)
+		}
+	}
+}
+
+// Flatten returns the errors joined in err with errors.Join, in order.
+func Flatten(err error) (errs []error) {
+	if err == nil {
+		return nil
+	}
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, Flatten(e)...)
+		}
+		return errs
+	}
+	var d Diagnostic
+	if errors.As(err, &d) {
+		return []error{d}
+	}
+	return []error{err}
+}
+
+func (d Diagnostic) render(w io.Writer, lines []string) {
+	fmt.Fprintln(w, d.Error())
+	start, end := d.Span.Start, d.Span.End
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.Line)))
+	if d.Span.IsValid() && start.Line <= len(lines) {
+		line := []rune(lines[start.Line-1])
+		// keep tabs in the padding, so the carets line up under the source
+		var pad strings.Builder
+		for i := 0; i < start.Column-1 && i < len(line); i++ {
+			if line[i] == '\t' {
+				pad.WriteRune('\t')
+			} else {
+				pad.WriteRune(' ')
+			}
+		}
+		width := len(line) - (start.Column - 1)
+		if end.Line == start.Line {
+			width = end.Column - start.Column
+		}
+		if width < 1 {
+			width = 1
+		}
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%d | %s\n", start.Line, string(line))
+		fmt.Fprintf(w, "%s | %s%s\n", gutter, pad.String(), strings.Repeat("^", width))
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s = note: %s\n", gutter, note)
+	}
+}
@@ -2,6 +2,8 @@ package env
 
 import (
 	"fmt"
+	"io"
+	"sort"
 
 	. "github.com/bigyihsuan/structlang/value"
 )
@@ -9,7 +11,8 @@ import (
 type Env struct {
 	Parent    *Env
 	Types     map[string]Type
-	Variables map[string]Value
+	Variables map[string]Value // a variable that is declared but not defined yet holds nil
+	captured  bool             // whether a function defined in e, or in an env inside it, can see e
 }
 
 func NewEnv() Env {
@@ -20,9 +23,9 @@ func NewEnv() Env {
 	}
 }
 
-func (e Env) MakeChild() Env {
+func (e *Env) MakeChild() Env {
 	return Env{
-		Parent:    &e,
+		Parent:    e,
 		Types:     make(map[string]Type),
 		Variables: make(map[string]Value),
 	}
@@ -31,6 +34,18 @@ func (e Env) MakeChild() Env {
 func (e *Env) DefineType(typeName string, structType Type) {
 	e.Types[typeName] = structType
 }
+
+// DefineMethod adds a method to the type typeName, in the env the type is defined in.
+// It reports false if there is no such type.
+func (e *Env) DefineMethod(typeName, name string, method Method) bool {
+	if t, ok := e.Types[typeName]; ok {
+		e.Types[typeName] = t.WithMethod(name, method)
+		return true
+	} else if e.Parent != nil {
+		return e.Parent.DefineMethod(typeName, name, method)
+	}
+	return false
+}
 func (e Env) GetType(typeName string) *Type {
 	if t, ok := e.Types[typeName]; ok {
 		return &t
@@ -41,20 +56,55 @@ func (e Env) GetType(typeName string) *Type {
 	}
 }
 
+// Declare adds a variable that isn't defined yet, like a function whose `let` hasn't been reached.
+// It hides any variable with the same name further out, but can't be used until it is defined.
+func (e *Env) Declare(name string) {
+	if _, ok := e.Variables[name]; !ok {
+		e.Variables[name] = nil
+	}
+}
+
+// Declares reports whether name is declared directly in e.
+func (e *Env) Declares(name string) bool {
+	_, ok := e.Variables[name]
+	return ok
+}
+
+// Capture records that a function defined in e can see e and every env around it.
+func (e *Env) Capture() {
+	for env := e; env != nil && !env.captured; env = env.Parent {
+		env.captured = true
+	}
+}
+
+// IsCaptured reports whether a function can see e.
+func (e *Env) IsCaptured() bool {
+	return e.captured
+}
+
+// DefineVariable and SetVariable store a copy of value, so that variables never share a struct.
 func (e *Env) DefineVariable(name string, value Value) {
-	e.Variables[name] = value
+	e.Variables[name] = Copy(value)
 }
 func (e *Env) SetVariable(name string, value Value) error {
 	if variable, ok := e.Variables[name]; !ok {
-		return fmt.Errorf("variable not defined: `%s`", name)
-	} else if variable.TypeName().Name != value.TypeName().Name {
-		return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", variable.TypeName().Name, value.TypeName().Name)
+		if e.Parent != nil {
+			return e.Parent.SetVariable(name, value)
+		}
+		return fmt.Errorf("variable `%s` not defined", name)
+	} else if variable == nil {
+		return fmt.Errorf("variable `%s` not defined", name)
+	} else if !variable.TypeName().Equal(value.TypeName()) {
+		return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", variable.TypeName(), value.TypeName())
 	}
-	e.Variables[name] = value
+	e.Variables[name] = Copy(value)
 	return nil
 }
 func (e Env) GetVariable(name string) *Value {
 	if t, ok := e.Variables[name]; ok {
+		if t == nil {
+			return nil
+		}
 		return &t
 	} else if e.Parent != nil {
 		return e.Parent.GetVariable(name)
@@ -62,3 +112,31 @@ func (e Env) GetVariable(name string) *Value {
 		return nil
 	}
 }
+
+// DumpTypes writes the types defined directly in e, sorted by name.
+func (e Env) DumpTypes(w io.Writer) {
+	names := make([]string, 0, len(e.Types))
+	for id := range e.Types {
+		names = append(names, id)
+	}
+	sort.Strings(names)
+	for _, id := range names {
+		fmt.Fprintf(w, "%s = %s\n", id, e.Types[id].String())
+	}
+}
+
+// DumpVariables writes the variables defined directly in e, sorted by name.
+func (e Env) DumpVariables(w io.Writer) {
+	names := make([]string, 0, len(e.Variables))
+	for id := range e.Variables {
+		names = append(names, id)
+	}
+	sort.Strings(names)
+	for _, id := range names {
+		val := e.Variables[id]
+		if val == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s %s = %s\n", id, val.TypeName(), val.PrintString())
+	}
+}
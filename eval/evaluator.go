@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/diag"
 	. "github.com/bigyihsuan/structlang/env"
 	"github.com/bigyihsuan/structlang/token"
 	"github.com/bigyihsuan/structlang/trees/ast"
@@ -16,50 +17,264 @@ import (
 type Evaluator struct {
 	Code    []ast.Stmt
 	BaseEnv Env
+	loops   int // the loops around the statement being evaluated, inside the function being called
+	depth   int // the calls running, up to builtin.MaxCallDepth
 }
 
+// jump is what `break` and `continue` evaluate to. Like the value of a `return`,
+// it stops the enclosing statements, until the innermost loop sees it.
+type jump struct {
+	kw token.TokenType
+}
+
+func (j jump) Get(field string) Value { return nil }
+func (j jump) TypeName() TypeName     { return TypeName{Name: j.kw.String()} }
+func (j jump) Return(bool) Value      { return j }
+func (j jump) Unwrap() any            { return j.kw }
+func (j jump) PrintString() string    { return j.kw.String() }
+
 func NewEvaluator(code []ast.Stmt) Evaluator {
 	var e Evaluator
 	e.Code = code
-	e.BaseEnv = NewEnv()
+	// the primitives live in a parent of BaseEnv, so that only the user's types are dumped
+	universe := NewEnv()
+	builtin.DefinePrimitives(&universe)
+	e.BaseEnv = universe.MakeChild()
 	return e
 }
 
+// Evaluate runs stmts in currEnv, or the whole program if there are none.
+// A runtime error stops the top-level statement it happened in, including the rest of any
+// function or block it is in, and the program goes on with the next top-level statement, like in the vm.
+// All errors are returned together.
 func (e *Evaluator) Evaluate(currEnv *Env, stmts ...[]ast.Stmt) (Value, error) {
-	var errs error
-	code := e.Code
 	if len(stmts) > 0 {
-		code = stmts[0]
+		return e.run(currEnv, stmts[0])
+	}
+	var errs error
+	for _, stmt := range e.Code {
+		val, err := e.run(currEnv, []ast.Stmt{stmt})
+		errs = errors.Join(errs, err)
+		if val != nil {
+			return val, errs
+		}
 	}
+	return nil, errs
+}
 
-	for _, stmt := range code {
-		var err error = nil
+// run runs stmts until one of them returns, jumps out of a loop, or fails.
+func (e *Evaluator) run(currEnv *Env, stmts []ast.Stmt) (Value, error) {
+	e.hoist(currEnv, stmts)
+	for _, stmt := range stmts {
+		var val Value
+		var err error
 		switch stmt := stmt.(type) {
 		case ast.TypeDef:
 			err = e.TypeDef(currEnv, stmt)
 		case ast.VarDef:
+			currEnv = e.letEnv(currEnv, stmt)
 			err = e.VarDef(currEnv, stmt)
 		case ast.VarSet:
 			err = e.VarSet(currEnv, stmt)
 		case ast.ExprStmt:
 			_, err = e.Expr(currEnv, stmt.Expr)
 		case ast.ReturnStmt:
-			return e.ReturnStmt(currEnv, stmt)
+			val, err = e.ReturnStmt(currEnv, stmt)
+			return val, diag.Wrap(stmt, err)
+		// a non-nil value from a statement with a body means a `return`, `break` or `continue` was hit inside it
+		case ast.IfStmt:
+			val, err = e.IfStmt(currEnv, stmt)
+		case ast.WhileStmt:
+			val, err = e.WhileStmt(currEnv, stmt)
+		case ast.ForStmt:
+			val, err = e.ForStmt(currEnv, stmt)
+		case ast.BreakStmt:
+			if e.loops == 0 {
+				err = errors.New("`break` outside of a loop")
+			} else {
+				val = jump{kw: token.BREAK}
+			}
+		case ast.ContinueStmt:
+			if e.loops == 0 {
+				err = errors.New("`continue` outside of a loop")
+			} else {
+				val = jump{kw: token.CONTINUE}
+			}
+		case ast.MatchStmt:
+			val, err = e.MatchStmt(currEnv, stmt)
+		case ast.MethodDef:
+			err = e.MethodDef(currEnv, stmt)
 		default:
 			fmt.Printf("eval unknown stmt: %T\n", stmt)
 		}
+		if val != nil || err != nil {
+			return val, diag.Wrap(stmt, err)
+		}
+	}
+	return nil, nil
+}
+
+// hoist declares the functions defined in stmts before any of them runs, like the checker and the vm do,
+// so that functions in the same block can call each other no matter which one comes first.
+func (e *Evaluator) hoist(currEnv *Env, stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		if varDef, isVarDef := stmt.(ast.VarDef); isVarDef {
+			ident, isIdent := varDef.Lvalue.(ast.Ident)
+			if _, isFunc := varDef.Rvalue.(ast.FuncDef); isIdent && isFunc {
+				currEnv.Declare(ident.Name)
+			}
+		}
+	}
+}
+
+// letEnv gives the env that a `let` defines its variable in.
+// A function sees the variables that were declared where it was defined, like in the vm, so a new variable
+// of an env that a function can already see goes in a child env, which only the statements after the `let` see.
+// The top level is the exception, where a function can use a variable that is defined after it.
+func (e *Evaluator) letEnv(currEnv *Env, varDef ast.VarDef) *Env {
+	ident, isIdent := varDef.Lvalue.(ast.Ident)
+	if !isIdent || currEnv == &e.BaseEnv || !currEnv.IsCaptured() || currEnv.Declares(ident.Name) {
+		return currEnv
+	}
+	child := currEnv.MakeChild()
+	return &child
+}
+
+func (e *Evaluator) Block(currEnv *Env, block ast.Block) (Value, error) {
+	blockEnv := currEnv.MakeChild()
+	return e.Evaluate(&blockEnv, block.Stmts)
+}
+
+func (e *Evaluator) IfStmt(currEnv *Env, stmt ast.IfStmt) (Value, error) {
+	cond, err := e.Cond(currEnv, stmt.Cond)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return e.Block(currEnv, stmt.Then)
+	} else if stmt.Else != nil {
+		return e.Block(currEnv, *stmt.Else)
+	}
+	return nil, nil
+}
+
+func (e *Evaluator) WhileStmt(currEnv *Env, stmt ast.WhileStmt) (Value, error) {
+	e.loops++
+	defer func() { e.loops-- }()
+	for {
+		cond, err := e.Cond(currEnv, stmt.Cond)
 		if err != nil {
-			errs = errors.Join(errs, err)
+			return nil, err
+		}
+		if !cond {
+			return nil, nil
+		}
+		bodyEnv := currEnv.MakeChild()
+		if stop, val, err := e.loopBody(&bodyEnv, stmt.Body); stop {
+			return val, err
 		}
 	}
-	return nil, errs
 }
 
-func (e *Evaluator) TypeDef(currEnv *Env, stmt ast.TypeDef) error {
-	typename, _ := e.TypeName(currEnv, stmt.Type)
-	structdef, _ := e.StructDef(currEnv, stmt.StructDef)
+func (e *Evaluator) ForStmt(currEnv *Env, stmt ast.ForStmt) (Value, error) {
+	iterable, err := e.Expr(currEnv, stmt.Iterable)
+	if err != nil {
+		return nil, err
+	}
+	var it builtin.Iterator
+	if stmt.End != nil {
+		end, err := e.Expr(currEnv, stmt.End)
+		if err != nil {
+			return nil, err
+		}
+		it, err = builtin.Range(iterable, end)
+		if err != nil {
+			return nil, err
+		}
+	} else if it, err = builtin.Iterate(iterable, stmt.Index != nil, currEnv.GetType, e.call); err != nil {
+		return nil, err
+	}
+	e.loops++
+	defer func() { e.loops-- }()
+	for {
+		index, elem, ok, err := it.Next()
+		if !ok || err != nil {
+			return nil, err
+		}
+		// like a match arm, the names are in the same env as the body
+		bodyEnv := currEnv.MakeChild()
+		if stmt.Index != nil {
+			bodyEnv.DefineVariable(stmt.Index.Name, index)
+		}
+		bodyEnv.DefineVariable(stmt.Elem.Name, elem)
+		if stop, val, err := e.loopBody(&bodyEnv, stmt.Body); stop {
+			return val, err
+		}
+	}
+}
+
+// loopBody runs the body of a loop once in bodyEnv, and reports whether the loop stops,
+// which it does on a `break`, a `return` whose value is val, or an error.
+func (e *Evaluator) loopBody(bodyEnv *Env, body ast.Block) (stop bool, val Value, err error) {
+	val, err = e.Evaluate(bodyEnv, body.Stmts)
+	if err != nil {
+		return true, nil, err
+	}
+	if j, isJump := val.(jump); isJump {
+		return j.kw == token.BREAK, nil, nil
+	}
+	return val != nil, val, nil
+}
 
-	currEnv.DefineType(typename.Name, structdef)
+func (e *Evaluator) MatchStmt(currEnv *Env, stmt ast.MatchStmt) (Value, error) {
+	subject, err := e.Expr(currEnv, stmt.Subject)
+	if err != nil {
+		return nil, err
+	}
+	for _, arm := range stmt.Arms {
+		armType, err := e.TypeName(currEnv, arm.Type)
+		if err != nil {
+			return nil, err
+		}
+		held, matches := builtin.Narrow(subject, armType)
+		if !matches {
+			continue
+		}
+		armEnv := currEnv.MakeChild()
+		if arm.Binding != nil {
+			armEnv.DefineVariable(arm.Binding.Name, held)
+		}
+		return e.Evaluate(&armEnv, arm.Body.Stmts)
+	}
+	return nil, fmt.Errorf("no match arm for value of type `%s`", subject.TypeName())
+}
+
+func (e *Evaluator) Cond(currEnv *Env, expr ast.Expr) (bool, error) {
+	v, err := e.Expr(currEnv, expr)
+	if err != nil {
+		return false, err
+	}
+	cond, isBool := v.(builtin.BoolValue)
+	if !isBool {
+		return false, diag.Errorf(expr, "condition must be `bool`, got `%s`", v.TypeName())
+	}
+	return cond.Unwrap().(bool), nil
+}
+
+func (e *Evaluator) TypeDef(currEnv *Env, stmt ast.TypeDef) error {
+	typename := typeName(stmt.Type)
+	if builtin.IsBuiltin(typename.Name) {
+		return fmt.Errorf("cannot redefine builtin type `%s`", typename.Name)
+	}
+	var structdef Type
+	if stmt.Alias != nil {
+		alias := typeName(*stmt.Alias)
+		structdef = Type{Fields: make(map[string]TypeName), Vars: typename.Vars, Alias: &alias}
+	} else {
+		structdef, _ = e.StructDef(currEnv, stmt.StructDef)
+	}
+	// aliases are resolved now, so that they mean what they did where the type was defined
+	currEnv.DefineType(typename.Name, structdef.Resolve(currEnv.GetType))
 	return nil
 }
 
@@ -68,36 +283,42 @@ func (e *Evaluator) StructDef(currEnv *Env, structDef ast.StructDef) (st Type, e
 	st.Vars = make([]TypeName, len(structDef.Vars))
 
 	for _, structField := range structDef.Fields {
-		fieldType, err := e.TypeName(currEnv, structField.Type)
-		if err != nil {
-			return st, err
+		fieldType := typeName(structField.Type)
+		if structField.IsEmbedded() {
+			st.Fields[fieldType.Name] = fieldType
+			st.Embedded = append(st.Embedded, fieldType.Name)
 		}
 		for _, fieldName := range structField.Names {
 			st.Fields[fieldName.Name] = fieldType
 		}
 	}
 	for i, typeVar := range structDef.Vars {
-		tn, err := e.TypeName(currEnv, typeVar)
-		if err != nil {
-			return st, err
-		}
-		st.Vars[i] = tn
+		st.Vars[i] = typeName(typeVar)
 	}
 
 	return st, nil
 }
 
+// TypeName resolves a type written in the source, seeing through aliases.
 func (e *Evaluator) TypeName(currEnv *Env, typename ast.Type) (TypeName, error) {
-	var type_ TypeName
-	name := typename.Name.Name
+	return typeName(typename).Resolve(currEnv.GetType), nil
+}
+
+func (e *Evaluator) typeArgs(currEnv *Env, typeArgs []ast.Type) []TypeName {
+	types := []TypeName{}
+	for _, typeArg := range typeArgs {
+		types = append(types, typeName(typeArg).Resolve(currEnv.GetType))
+	}
+	return types
+}
+
+// typeName converts a type written in the source into a TypeName, as it is written.
+func typeName(typename ast.Type) TypeName {
 	vars := []TypeName{}
 	for _, typeArg := range typename.Vars {
-		arg, _ := e.TypeName(currEnv, typeArg)
-		vars = append(vars, arg)
+		vars = append(vars, typeName(typeArg))
 	}
-	type_.Name = name
-	type_.Vars = vars
-	return type_, nil
+	return TypeName{Name: typename.Name.Name, Vars: vars}
 }
 
 func (e *Evaluator) VarDef(currEnv *Env, varDef ast.VarDef) error {
@@ -114,14 +335,39 @@ func (e *Evaluator) VarDef(currEnv *Env, varDef ast.VarDef) error {
 }
 
 func (e *Evaluator) VarSet(currEnv *Env, varSet ast.VarSet) error {
-	lvalue, err := e.Lvalue(currEnv, varSet.Lvalue)
+	rvalue, err := e.Expr(currEnv, varSet.Rvalue)
 	if err != nil {
 		return err
 	}
-	rvalue, err := e.Expr(currEnv, varSet.Rvalue)
+	switch lv := varSet.Lvalue.(type) {
+	case ast.FieldAccess:
+		// the struct holding the field is updated in place
+		holder, err := e.Expr(currEnv, lv.Lvalue)
+		if err != nil {
+			return err
+		}
+		return builtin.SetField(holder, lv.Field.Name, rvalue)
+	case ast.Index:
+		// and so is the list holding the element
+		holder, err := e.Expr(currEnv, lv.Lvalue)
+		if err != nil {
+			return err
+		}
+		index, err := e.Expr(currEnv, lv.Index)
+		if err != nil {
+			return err
+		}
+		return builtin.SetIndex(holder, index, rvalue)
+	}
+	lvalue, err := e.Lvalue(currEnv, varSet.Lvalue)
 	if err != nil {
 		return err
 	}
+	if current := currEnv.GetVariable(lvalue.Name); current != nil {
+		if coerced, ok := builtin.Coerce(rvalue, (*current).TypeName()); ok {
+			rvalue = coerced
+		}
+	}
 	return currEnv.SetVariable(lvalue.Name, rvalue)
 }
 
@@ -131,12 +377,16 @@ func (e *Evaluator) Lvalue(currEnv *Env, lvalue ast.Lvalue) (Identifier, error)
 		ident := NewIdentifier(lvalue)
 		return ident, nil
 	case ast.FieldAccess:
-		base, err := e.Lvalue(currEnv, lvalue.Lvalue)
+		root, err := e.Lvalue(currEnv, lvalue.Lvalue)
 		if err != nil {
-			return base, err
+			return root, err
 		}
-		ident := base.NewAccess(lvalue.Field)
-		return ident, nil
+		last := &root
+		for last.Field != nil {
+			last = last.Field
+		}
+		last.NewAccess(lvalue.Field)
+		return root, nil
 	default:
 		fmt.Printf("eval unknown lvalue: %T\n", lvalue)
 	}
@@ -144,6 +394,8 @@ func (e *Evaluator) Lvalue(currEnv *Env, lvalue ast.Lvalue) (Identifier, error)
 }
 
 func (e *Evaluator) Expr(currEnv *Env, expr ast.Expr) (v Value, err error) {
+	// a runtime error points at the innermost expression it happened in
+	defer func() { err = diag.Wrap(expr, err) }()
 	switch expr := expr.(type) {
 	case ast.Literal:
 		return e.Literal(currEnv, expr)
@@ -159,8 +411,22 @@ func (e *Evaluator) Expr(currEnv *Env, expr ast.Expr) (v Value, err error) {
 		return *val, nil
 	case ast.StructLiteral:
 		return e.StructLiteral(currEnv, expr)
+	case ast.ListLiteral:
+		return e.ListLiteral(currEnv, expr)
+	case ast.MapLiteral:
+		return e.MapLiteral(currEnv, expr)
 	case ast.FieldAccess:
 		return e.FieldAccess(currEnv, expr)
+	case ast.Index:
+		base, err := e.Expr(currEnv, expr.Lvalue)
+		if err != nil {
+			return v, err
+		}
+		index, err := e.Expr(currEnv, expr.Index)
+		if err != nil {
+			return v, err
+		}
+		return builtin.Index(base, index)
 	case ast.PrefixExpr:
 		return e.PrefixExpr(currEnv, expr)
 	case ast.InfixExpr:
@@ -171,6 +437,18 @@ func (e *Evaluator) Expr(currEnv *Env, expr ast.Expr) (v Value, err error) {
 		return e.FuncCallExpr(currEnv, expr)
 	case ast.FuncDef:
 		return e.FuncDef(currEnv, expr)
+	case ast.IsExpr:
+		return e.IsExpr(currEnv, expr)
+	case ast.Instantiation:
+		fn, err := e.Expr(currEnv, expr.Name)
+		if err != nil {
+			return fn, err
+		}
+		f, isFunc := fn.(builtin.Func)
+		if !isFunc {
+			return nil, fmt.Errorf("cannot give type parameters to non-function of type `%s`", fn.TypeName())
+		}
+		return f.Instantiate(e.typeArgs(currEnv, expr.TypeArgs))
 	default:
 		fmt.Printf("eval unknown expr: %T\n", expr)
 	}
@@ -211,51 +489,67 @@ func (e *Evaluator) TypeVars(currEnv *Env, types []ast.Type) (tv []TypeName, err
 func (e *Evaluator) StructLiteral(currEnv *Env, expr ast.StructLiteral) (v Value, err error) {
 	// basic duck typing
 	// check if all names+types in the struct literal match the ones in the type definition
-	typename := expr.TypeName.Name.Name
-	st := currEnv.GetType(typename)
+	typeVars, err := e.TypeVars(currEnv, expr.TypeName.Vars)
+	if err != nil {
+		return v, err
+	}
+	typename := TypeName{Name: expr.TypeName.Name.Name, Vars: typeVars}.Resolve(currEnv.GetType)
+	st := currEnv.GetType(typename.Name)
 	if st == nil {
-		return v, fmt.Errorf("type not found: %s", typename)
+		return v, fmt.Errorf("type not found: %s", typename.Name)
 	}
-	structTemplate := (*st).Copy()
 
-	typeVars, err := e.TypeVars(currEnv, expr.TypeName.Vars)
+	fields := []util.Pair[string, Value]{}
+	for _, field := range expr.Fields {
+		val, err := e.Expr(currEnv, field.Value)
+		if err != nil {
+			return v, err
+		}
+		fields = append(fields, util.Pair[string, Value]{First: field.Name.Name, Last: val})
+	}
+	return builtin.NewStructLiteral(*st, typename, fields, currEnv.GetType)
+}
+
+func (e *Evaluator) ListLiteral(currEnv *Env, expr ast.ListLiteral) (v Value, err error) {
+	ty, err := e.TypeName(currEnv, expr.TypeName)
 	if err != nil {
 		return v, err
 	}
-	if len(typeVars) != len(structTemplate.Vars) {
-		return v, fmt.Errorf("not enough type parameters: want %d, got %d", len(structTemplate.Vars), len(typeVars))
+	if !ty.IsList() {
+		return v, fmt.Errorf("cannot build `%s` with a list literal", ty)
 	}
-
-	// overwrite template type variables with concrete types
-	typeParams := make(map[string]TypeName)
-	for idx, concreteType := range typeVars {
-		typeVar := structTemplate.Vars[idx]
-		for name, fieldType := range structTemplate.Fields {
-			if fieldType.Name == typeVar.Name {
-				structTemplate.Fields[name] = concreteType
-				typeParams[fieldType.Name] = concreteType
-			}
+	elems := []Value{}
+	for _, elem := range expr.Elems {
+		val, err := e.Expr(currEnv, elem)
+		if err != nil {
+			return v, err
 		}
+		elems = append(elems, val)
 	}
+	return builtin.NewList(ty.Vars[0], elems)
+}
 
-	fields := make(map[string]Value)
-	for _, field := range expr.Fields {
-		name := field.Name.Name
-		val, err := e.Expr(currEnv, field.Value)
+func (e *Evaluator) MapLiteral(currEnv *Env, expr ast.MapLiteral) (v Value, err error) {
+	ty, err := e.TypeName(currEnv, expr.TypeName)
+	if err != nil {
+		return v, err
+	}
+	if !ty.IsMap() {
+		return v, fmt.Errorf("cannot build `%s` with a map literal", ty)
+	}
+	keys, vals := []Value{}, []Value{}
+	for _, entry := range expr.Entries {
+		key, err := e.Expr(currEnv, entry.Key)
 		if err != nil {
 			return v, err
 		}
-		expFieldType, ok := structTemplate.Fields[name]
-		if !ok {
-			return v, fmt.Errorf("field `%s` not found in type `%s`", name, typename)
-		} else if valType := val.TypeName().Name; valType != expFieldType.Name {
-			return v, fmt.Errorf("unexpected type for field `%s`: got `%s`, want `%s`", name, valType, expFieldType.Name)
+		val, err := e.Expr(currEnv, entry.Value)
+		if err != nil {
+			return v, err
 		}
-		fields[name] = val
+		keys, vals = append(keys, key), append(vals, val)
 	}
-	sv := NewStructFromType(structTemplate, typeParams, fields, typename)
-
-	return sv, nil
+	return builtin.NewMap(ty.Vars[0], ty.Vars[1], keys, vals)
 }
 
 func (e *Evaluator) FieldAccess(currEnv *Env, expr ast.FieldAccess) (v Value, err error) {
@@ -267,14 +561,18 @@ func (e *Evaluator) FieldAccess(currEnv *Env, expr ast.FieldAccess) (v Value, er
 			return v, fmt.Errorf("variable `%s` not defined", l.Name)
 		}
 		base = *b
-	case ast.FieldAccess:
-		b, err := e.FieldAccess(currEnv, l)
+	default:
+		b, err := e.Expr(currEnv, l)
 		if err != nil {
 			return v, err
 		}
 		base = b
 	}
-	return base.Get(expr.Field.Name), nil
+	field := base.Get(expr.Field.Name)
+	if field == nil {
+		return nil, fmt.Errorf("field `%s` not found in type `%s`", expr.Field.Name, base.TypeName())
+	}
+	return field, nil
 }
 
 func (e *Evaluator) PrefixExpr(currEnv *Env, expr ast.PrefixExpr) (v Value, err error) {
@@ -282,23 +580,7 @@ func (e *Evaluator) PrefixExpr(currEnv *Env, expr ast.PrefixExpr) (v Value, err
 	if err != nil {
 		return v, err
 	}
-
-	if neg, isNeg := v.(builtin.Neg); isNeg {
-		switch expr.Op.Type() {
-		case token.PLUS:
-			return neg.Pos(), nil
-		case token.MINUS:
-			return neg.Neg(), nil
-		}
-	}
-	if log, isLog := v.(builtin.Log); isLog {
-		switch expr.Op.Type() {
-		case token.NOT:
-			return log.Not(), nil
-		}
-	}
-
-	return v, fmt.Errorf("invalid type `%T` for prefix op `%s`", v, expr.Op.Type())
+	return builtin.Prefix(expr.Op.Type(), v)
 }
 
 func (e *Evaluator) InfixExpr(currEnv *Env, expr ast.InfixExpr) (v Value, err error) {
@@ -310,58 +592,20 @@ func (e *Evaluator) InfixExpr(currEnv *Env, expr ast.InfixExpr) (v Value, err er
 	if err != nil {
 		return right, err
 	}
+	return builtin.Infix(expr.Op.Type(), left, right)
+}
 
-	lsum, isLsum := left.(builtin.Sum)
-	rsum, isRsum := right.(builtin.Sum)
-	if isLsum && isRsum {
-		switch expr.Op.Type() {
-		case token.PLUS:
-			return lsum.Add(rsum), nil
-		case token.MINUS:
-			return lsum.Sub(rsum), nil
-		}
-	}
-
-	lprod, isLprod := left.(builtin.Product)
-	rprod, isRprod := right.(builtin.Product)
-	if isLprod && isRprod {
-		switch expr.Op.Type() {
-		case token.STAR:
-			return lprod.Mul(rprod), nil
-		case token.SLASH:
-			return lprod.Div(rprod), nil
-		}
-	}
-
-	lcmp, isLcmp := left.(builtin.Cmp)
-	rcmp, isRcmp := right.(builtin.Cmp)
-	if isLcmp && isRcmp {
-		switch expr.Op.Type() {
-		case token.GT:
-			return lcmp.Gt(rcmp), nil
-		case token.GTEQ:
-			return lcmp.GtEq(rcmp), nil
-		case token.LT:
-			return lcmp.Lt(rcmp), nil
-		case token.LTEQ:
-			return lcmp.LtEq(rcmp), nil
-		case token.EQ:
-			return lcmp.Eq(rcmp), nil
-		}
+func (e *Evaluator) IsExpr(currEnv *Env, expr ast.IsExpr) (v Value, err error) {
+	left, err := e.Expr(currEnv, expr.Left)
+	if err != nil {
+		return left, err
 	}
-
-	llog, isLlog := left.(builtin.Log)
-	rlog, isRlog := right.(builtin.Log)
-	if isLlog && isRlog {
-		switch expr.Op.Type() {
-		case token.AND:
-			return llog.And(rlog), nil
-		case token.OR:
-			return llog.Or(rlog), nil
-		}
+	ty, err := e.TypeName(currEnv, expr.Type)
+	if err != nil {
+		return v, err
 	}
-
-	return v, fmt.Errorf("invalid types `%T` and `%T` for infix op `%s`", left, right, expr.Op.Type())
+	_, holds := builtin.Narrow(left, ty)
+	return builtin.NewBool(holds), nil
 }
 
 func (e *Evaluator) GroupingExpr(currEnv *Env, expr ast.GroupingExpr) (v Value, err error) {
@@ -377,47 +621,126 @@ func (e *Evaluator) FuncCallExpr(currEnv *Env, expr ast.FuncCallExpr) (v Value,
 		}
 		args = append(args, arg)
 	}
-	name, err := e.Lvalue(currEnv, expr.Name)
-	if err != nil {
-		return v, err
-	}
 
-	// TODO: return vals
-	var returnValue Value
-	if fn, isBuiltin := builtin.BuiltinFuncs()[name.Name]; isBuiltin {
-		returnValue = fn(args...)
-	} else if fn := currEnv.GetVariable(name.String()); fn == nil {
-		return v, fmt.Errorf("function `%s` not found", name.String())
+	var fn Value
+	if fa, isFieldAccess := expr.Name.(ast.FieldAccess); isFieldAccess {
+		// a method of the receiver, or a function in one of its fields
+		receiver, err := e.Expr(currEnv, fa.Lvalue)
+		if err != nil {
+			return v, err
+		}
+		if method, isMethod := builtin.MethodOf(receiver, fa.Field.Name, currEnv.GetType); isMethod {
+			fn = method
+			args = append([]Value{receiver}, args...)
+		} else if native, isNative := builtin.NativeMethod(receiver, fa.Field.Name); isNative {
+			return native(args...)
+		} else if fn = receiver.Get(fa.Field.Name); fn == nil {
+			return v, fmt.Errorf("field `%s` not found in type `%s`", fa.Field.Name, receiver.TypeName())
+		}
+	} else if _, isIndex := expr.Name.(ast.Index); isIndex {
+		if fn, err = e.Expr(currEnv, expr.Name); err != nil {
+			return v, err
+		}
 	} else {
-		fmt.Printf("eval: attempting to call func `%s` on `%v`\n", name.Name, args)
-		returnValue, err = (*fn).(builtin.Func).Call(e, args...)
+		name, err := e.Lvalue(currEnv, expr.Name)
+		if err != nil {
+			return v, err
+		}
+		if builtinFn, isBuiltin := builtin.BuiltinFuncs()[name.Name]; isBuiltin {
+			return builtinFn.Call(args...)
+		}
+		variable := currEnv.GetVariable(name.String())
+		if variable == nil {
+			return v, fmt.Errorf("variable `%s` not defined", name.String())
+		}
+		fn = *variable
+	}
+
+	f, isFunc := fn.(builtin.Func)
+	if !isFunc {
+		return v, fmt.Errorf("cannot call non-function of type `%s`", fn.TypeName())
+	}
+	if len(expr.TypeArgs) > 0 {
+		if f, err = f.Instantiate(e.typeArgs(currEnv, expr.TypeArgs)); err != nil {
+			return v, err
+		}
 	}
-	return returnValue, err
+	return e.call(f, args)
+}
+
+// call calls the function fn, whose body is outside of the loops around the call.
+func (e *Evaluator) call(fn Value, args []Value) (Value, error) {
+	f, isFunc := fn.(builtin.Func)
+	if !isFunc {
+		return nil, fmt.Errorf("cannot call non-function of type `%s`", fn.TypeName())
+	}
+	if e.depth >= builtin.MaxCallDepth {
+		return nil, builtin.ErrCallDepth
+	}
+	loops := e.loops
+	e.loops = 0
+	e.depth++
+	defer func() { e.loops = loops; e.depth-- }()
+	return f.Call(e, args...)
+}
+
+// MethodDef adds the method to the type of its receiver.
+func (e *Evaluator) MethodDef(currEnv *Env, stmt ast.MethodDef) error {
+	typeName := stmt.Receiver.Type.Name.Name
+	if err := builtin.ReceiverError(typeName, currEnv.GetType); err != nil {
+		return err
+	}
+	fn, err := e.FuncDef(currEnv, stmt.Func)
+	if err != nil {
+		return err
+	}
+	currEnv.DefineMethod(typeName, stmt.Name.Name, Method{Type: fn.TypeName(), Value: fn})
+	return nil
 }
 
 func (e *Evaluator) FuncDef(currEnv *Env, expr ast.FuncDef) (v Value, err error) {
-	args := []util.Pair[string, TypeName]{}
+	typeParams := []string{}
+	for _, typeParam := range expr.TypeParams {
+		typeParams = append(typeParams, typeParam.Name.Name)
+	}
+	params := []TypeName{}
 	for _, arg := range expr.Args {
-		name := arg.Name.Name
-		ty, err := e.TypeName(currEnv, arg.Type)
-		if err != nil {
-			return v, err
-		}
-		args = append(args, util.Pair[string, TypeName]{First: name, Last: ty})
+		params = append(params, typeName(arg.Type))
+	}
+	ret := builtin.NewNil().TypeName()
+	if expr.ReturnType != nil {
+		ret = typeName(*expr.ReturnType)
+	}
+	// resolved as a whole, so that the type parameters hide any types with the same names
+	signature := FuncType(params, ret)
+	signature.Params = typeParams
+	params, ret, _ = signature.Resolve(currEnv.GetType).FuncParts()
+
+	args := []util.Pair[string, TypeName]{}
+	for i, arg := range expr.Args {
+		args = append(args, util.Pair[string, TypeName]{First: arg.Name.Name, Last: params[i]})
 	}
 	body := expr.Body
+	currEnv.Capture()
 	return builtin.Func{
-		Args: args,
-		Body: body,
-		Env:  currEnv,
+		TypeParams: typeParams,
+		Args:       args,
+		Ret:        ret,
+		Body:       body,
+		Env:        currEnv,
 	}, err
 }
 
 func (e *Evaluator) ReturnStmt(currEnv *Env, stmt ast.ReturnStmt) (v Value, err error) {
 	if stmt.Expr != nil {
 		retVal, err := e.Expr(currEnv, stmt.Expr)
-		return retVal.Return(true), err
+		if err != nil {
+			return nil, err
+		}
+		// a non-nil value is what tells the enclosing statements to stop.
+		// Return isn't used, since the embedded Primitive's would turn an IntValue into a Primitive.
+		return retVal, nil
 	} else {
-		return builtin.NewNil().Return(false), nil
+		return builtin.NewNil(), nil
 	}
 }
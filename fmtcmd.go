@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/format"
+	"github.com/jessevdk/go-flags"
+)
+
+// fmtCommand is the `fmt` subcommand, which reprints code in canonical style.
+type fmtCommand struct {
+	Write bool `short:"w" long:"write" description:"Write the result back to the files instead of printing it."`
+	Args  struct {
+		Files []flags.Filename `positional-arg-name:"FILE" description:"Code files to format. Reads stdin if there are none."`
+	} `positional-args:"yes"`
+}
+
+func (c *fmtCommand) Execute(args []string) error {
+	if len(c.Args.Files) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		formatted, err := format.Source("", string(src))
+		if err != nil {
+			diag.Render(os.Stderr, string(src), err)
+			return errors.New("could not format stdin")
+		}
+		fmt.Print(formatted)
+		return nil
+	}
+
+	var errs error
+	for _, file := range c.Args.Files {
+		filename := string(file)
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		formatted, err := format.Source(filename, string(src))
+		if err != nil {
+			diag.Render(os.Stderr, string(src), err)
+			errs = errors.Join(errs, fmt.Errorf("could not format %s", filename))
+			continue
+		}
+		if !c.Write {
+			fmt.Print(formatted)
+		} else if formatted != string(src) {
+			if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+	return errs
+}
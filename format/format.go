@@ -0,0 +1,593 @@
+package format
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/lexer"
+	"github.com/bigyihsuan/structlang/parser"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/parsetree"
+)
+
+const indentation = "    "
+
+// Source formats the code in src. Code with illegal characters or syntax errors is not formatted.
+func Source(filename, src string) (string, error) {
+	lex, _ := lexer.NewLexer(src)
+	lex.SetFilename(filename)
+	var tokens []token.Token
+	for tok := lex.Lex(); tok.Type() != token.EOF; tok = lex.Lex() {
+		if tok.Type() == token.ILLEGAL {
+			return src, diag.At(diag.SpanOf(&tok, &tok), "illegal character `%s`", tok.Lexeme())
+		}
+		tokens = append(tokens, tok)
+	}
+	tokens, comments := lexer.ClearComments(tokens)
+	p := parser.NewParser(tokens)
+	stmts, err := p.Parse()
+	if err != nil {
+		return src, err
+	}
+	return Format(stmts, tokens, comments), nil
+}
+
+// Format reprints a program in canonical style, and puts its comments back where they were.
+//
+// Blocks and func bodies are indented by four spaces, binary operators are spaced, `->` is not,
+// and struct literals and struct definitions that were written over several lines get one field per line,
+// with the types of struct fields aligned. At most one blank line between statements is kept.
+//
+// tokens are the tokens stmts were parsed from, which tell where the comments go.
+func Format(stmts []parsetree.Stmt, tokens, comments []token.Token) string {
+	p := printer{tokens: tokens, comments: comments}
+	for _, stmt := range stmts {
+		p.Stmt(stmt)
+		p.newline()
+	}
+	p.flushComments(-1)
+	return p.sb.String()
+}
+
+type printer struct {
+	sb        strings.Builder
+	indent    int
+	tokens    []token.Token // every token of the code, in source order
+	comments  []token.Token // the comments that haven't been printed yet, in source order
+	offset    int           // the source offset of the last printed token
+	lastLine  int           // the source line of the last printed token or comment
+	midLine   bool          // whether something has been printed on the current output line
+	lastWrite string        // so that spaces aren't doubled
+}
+
+func (p *printer) write(s string) {
+	if !p.midLine {
+		p.sb.WriteString(strings.Repeat(indentation, p.indent))
+		p.midLine = true
+	}
+	p.sb.WriteString(s)
+	p.lastWrite = s
+}
+
+// newline ends the current line, along with the comment at the end of its source line,
+// unless tokens that haven't been printed yet come before that comment.
+func (p *printer) newline() {
+	if p.midLine && len(p.comments) > 0 && p.comments[0].Position().Line == p.lastLine && p.comments[0].Position().Offset < p.nextOffset() {
+		p.write(" " + p.comments[0].Lexeme())
+		p.comments = p.comments[1:]
+	}
+	p.sb.WriteString("\n")
+	p.midLine = false
+	p.lastWrite = "\n"
+}
+
+// nextOffset returns the source offset of the first token after the last printed one.
+func (p *printer) nextOffset() int {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Position().Offset > p.offset })
+	if i == len(p.tokens) {
+		return math.MaxInt
+	}
+	return p.tokens[i].Position().Offset
+}
+
+// blankLine keeps one blank line before something on line, if there was one in the source.
+func (p *printer) blankLine(line int) {
+	if !p.midLine && p.lastLine > 0 && line > p.lastLine+1 && p.sb.Len() > 0 && !strings.HasSuffix(p.sb.String(), "{\n") && !strings.HasSuffix(p.sb.String(), "\n\n") {
+		p.newline()
+	}
+}
+
+// tok prints tok, after the comments that come before it.
+func (p *printer) tok(tok token.Token) {
+	p.flushComments(tok.Position().Offset)
+	p.blankLine(tok.Position().Line)
+	if tok.Type() == token.STRING {
+		p.write(`"` + tok.Lexeme() + `"`)
+	} else {
+		p.write(tok.Lexeme())
+	}
+	p.lastLine = tok.Position().Line
+	p.offset = tok.Position().Offset
+}
+
+// flushComments prints the comments before offset, or all of them if offset is negative.
+// A comment on the same line as the last token stays at the end of that line.
+func (p *printer) flushComments(offset int) {
+	for len(p.comments) > 0 && (offset < 0 || p.comments[0].Position().Offset < offset) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+		line := comment.Position().Line
+		if p.midLine && line == p.lastLine {
+			p.write(" ")
+		} else if p.midLine {
+			p.newline()
+		}
+		p.blankLine(line)
+		p.write(comment.Lexeme())
+		p.lastLine = line
+		p.newline()
+	}
+}
+
+func (p *printer) space() {
+	if p.midLine && p.lastWrite != " " {
+		p.write(" ")
+	}
+}
+
+// Stmts prints the statements of a block, one per line, and the comments before the closing brace.
+func (p *printer) Stmts(stmts []parsetree.Stmt, rbrace token.Token) {
+	hasComments := len(p.comments) > 0 && p.comments[0].Position().Offset < rbrace.Position().Offset
+	if len(stmts) == 0 && !hasComments {
+		p.tok(rbrace)
+		return
+	}
+	p.newline()
+	p.indent++
+	for _, stmt := range stmts {
+		p.Stmt(stmt)
+		p.newline()
+	}
+	p.flushComments(rbrace.Position().Offset)
+	p.indent--
+	p.tok(rbrace)
+}
+
+func (p *printer) Stmt(stmt parsetree.Stmt) {
+	switch stmt := stmt.(type) {
+	case parsetree.ExprStmt:
+		p.Expr(stmt.Expr)
+		p.tok(stmt.Sc)
+	case parsetree.VarDef:
+		p.tok(stmt.LetKw)
+		p.space()
+		p.Expr(stmt.Lvalue)
+		p.space()
+		p.tok(stmt.Eq)
+		p.space()
+		p.Expr(stmt.Rvalue)
+		p.tok(stmt.Sc)
+	case parsetree.VarSet:
+		p.tok(stmt.SetKw)
+		p.space()
+		p.Expr(stmt.Lvalue)
+		p.space()
+		p.tok(stmt.Eq)
+		p.space()
+		p.Expr(stmt.Rvalue)
+		p.tok(stmt.Sc)
+	case parsetree.TypeDef:
+		p.tok(stmt.TypeKw)
+		p.space()
+		p.Type(stmt.TypeName)
+		p.space()
+		p.tok(stmt.Eq)
+		p.space()
+		if stmt.Alias != nil {
+			p.Type(*stmt.Alias)
+		} else {
+			p.StructDef(stmt.StructDef)
+		}
+		p.tok(stmt.Sc)
+	case parsetree.MethodDef:
+		p.tok(stmt.FuncKw)
+		p.space()
+		p.tok(stmt.Lparen)
+		p.tok(stmt.Receiver.Name.Name)
+		p.space()
+		p.Type(stmt.Receiver.Type)
+		p.tok(stmt.Rparen)
+		p.space()
+		p.tok(stmt.Name.Name)
+		p.funcRest(stmt.Func)
+	case parsetree.ReturnStmt:
+		p.tok(stmt.ReturnKw)
+		if stmt.Expr != nil {
+			p.space()
+			p.Expr(stmt.Expr)
+		}
+		p.tok(stmt.Sc)
+	case parsetree.IfStmt:
+		p.IfStmt(stmt)
+	case parsetree.WhileStmt:
+		p.tok(stmt.WhileKw)
+		p.space()
+		p.Expr(stmt.Cond)
+		p.space()
+		p.Block(stmt.Body)
+	case parsetree.ForStmt:
+		p.tok(stmt.ForKw)
+		p.space()
+		if stmt.Index != nil {
+			p.tok(stmt.Index.Name)
+			p.tok(*stmt.Comma)
+			p.space()
+		}
+		p.tok(stmt.Elem.Name)
+		p.space()
+		p.tok(stmt.InKw)
+		p.space()
+		p.Expr(stmt.Iterable)
+		if stmt.DotDot != nil {
+			p.tok(*stmt.DotDot)
+			p.Expr(stmt.End)
+		}
+		p.space()
+		p.Block(stmt.Body)
+	case parsetree.BreakStmt:
+		p.tok(stmt.BreakKw)
+		p.tok(stmt.Sc)
+	case parsetree.ContinueStmt:
+		p.tok(stmt.ContinueKw)
+		p.tok(stmt.Sc)
+	case parsetree.MatchStmt:
+		p.tok(stmt.MatchKw)
+		p.space()
+		p.Expr(stmt.Subject)
+		p.space()
+		p.tok(stmt.Lbrace)
+		p.newline()
+		p.indent++
+		for _, arm := range stmt.Arms {
+			if arm.Binding != nil {
+				p.tok(arm.Binding.Name)
+				p.space()
+			}
+			p.Type(arm.Type)
+			p.space()
+			p.Block(arm.Body)
+			p.newline()
+		}
+		p.flushComments(stmt.Rbrace.Position().Offset)
+		p.indent--
+		p.tok(stmt.Rbrace)
+	default:
+		p.write(stmt.String())
+	}
+}
+
+func (p *printer) IfStmt(stmt parsetree.IfStmt) {
+	p.tok(stmt.IfKw)
+	p.space()
+	p.Expr(stmt.Cond)
+	p.space()
+	p.Block(stmt.Then)
+	if stmt.Else != nil {
+		p.space()
+		p.tok(stmt.Else.ElseKw)
+		p.space()
+		if stmt.Else.If != nil {
+			p.IfStmt(*stmt.Else.If)
+		} else {
+			p.Block(*stmt.Else.Block)
+		}
+	}
+}
+
+func (p *printer) Block(block parsetree.Block) {
+	p.tok(block.Lbrace)
+	p.Stmts(block.Stmts, block.Rbrace)
+}
+
+func (p *printer) Type(ty parsetree.Type) {
+	if ty.Func != nil {
+		p.FuncType(*ty.Func)
+		return
+	}
+	p.tok(ty.TypeName.Name)
+	if ty.TypeVars != nil {
+		p.TypeVars(*ty.TypeVars)
+	}
+}
+
+func (p *printer) FuncType(ft parsetree.FuncType) {
+	p.tok(ft.FuncKw)
+	p.tok(ft.Lparen)
+	for i, pair := range ft.Params {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.Type(pair.First)
+	}
+	p.tok(ft.Rparen)
+	if ft.Return != nil {
+		p.write(" ")
+		p.Type(*ft.Return)
+	}
+}
+
+func (p *printer) TypeVars(tvs parsetree.TypeVars) {
+	p.tok(tvs.Lbracket)
+	for i, pair := range tvs.TypeVars {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.Type(pair.First)
+	}
+	p.tok(tvs.Rbracket)
+}
+
+func (p *printer) StructDef(sd parsetree.StructDef) {
+	p.tok(sd.StructKw)
+	if sd.TypeVars != nil {
+		p.TypeVars(*sd.TypeVars)
+	}
+	p.tok(sd.Lbrace)
+	if len(sd.Fields) == 0 {
+		p.tok(sd.Rbrace)
+		return
+	}
+	if sd.Lbrace.Position().Line == sd.Rbrace.Position().Line {
+		p.write(" ")
+		for i, field := range sd.Fields {
+			if i > 0 {
+				p.write("; ")
+			}
+			if len(field.Names) > 0 {
+				p.names(field.Names)
+				p.write(" ")
+			}
+			p.Type(field.Type)
+		}
+		p.write(" ")
+		p.tok(sd.Rbrace)
+		return
+	}
+
+	// one field per line, with the types lined up
+	width := 0
+	for _, field := range sd.Fields {
+		if w := namesWidth(field.Names); w > width {
+			width = w
+		}
+	}
+	p.newline()
+	p.indent++
+	for _, field := range sd.Fields {
+		if len(field.Names) > 0 {
+			// embedded fields aren't lined up, since they have no name
+			p.names(field.Names)
+			p.write(strings.Repeat(" ", width-namesWidth(field.Names)+1))
+		}
+		p.Type(field.Type)
+		if field.Sc != nil {
+			p.tok(*field.Sc)
+		} else {
+			p.write(";")
+		}
+		p.newline()
+	}
+	p.flushComments(sd.Rbrace.Position().Offset)
+	p.indent--
+	p.tok(sd.Rbrace)
+}
+
+func (p *printer) names(names parsetree.SeparatedList[parsetree.Ident, token.Token]) {
+	for i, pair := range names {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.tok(pair.First.Name)
+	}
+}
+
+func namesWidth(names parsetree.SeparatedList[parsetree.Ident, token.Token]) (width int) {
+	for i, pair := range names {
+		if i > 0 {
+			width += len(", ")
+		}
+		width += len([]rune(pair.First.Name.Lexeme()))
+	}
+	return width
+}
+
+func (p *printer) Expr(expr parsetree.Expr) {
+	switch expr := expr.(type) {
+	case parsetree.Literal:
+		p.tok(expr.Token)
+	case parsetree.Ident:
+		p.tok(expr.Name)
+	case parsetree.FieldAccess:
+		p.Expr(expr.Lvalue)
+		p.tok(expr.Arrow)
+		p.tok(expr.Field.Name)
+	case parsetree.Index:
+		p.Expr(expr.Lvalue)
+		p.tok(expr.Arrow)
+		p.tok(expr.Lbracket)
+		p.Expr(expr.Index)
+		p.tok(expr.Rbracket)
+	case parsetree.StructLiteral:
+		p.StructLiteral(expr)
+	case parsetree.ListLiteral:
+		p.ListLiteral(expr)
+	case parsetree.MapLiteral:
+		p.MapLiteral(expr)
+	case parsetree.PrefixExpr:
+		p.tok(expr.Op)
+		if expr.Op.Type() == token.NOT {
+			p.space()
+		}
+		p.Expr(expr.Right)
+	case parsetree.InfixExpr:
+		p.Expr(expr.Left)
+		p.space()
+		p.tok(expr.Op)
+		p.space()
+		p.Expr(expr.Right)
+	case parsetree.IsExpr:
+		p.Expr(expr.Left)
+		p.space()
+		p.tok(expr.IsKw)
+		p.space()
+		p.Type(expr.Type)
+	case parsetree.GroupingExpr:
+		p.tok(expr.Lparen)
+		p.Expr(expr.Expr)
+		p.tok(expr.Rparen)
+	case parsetree.FuncCallExpr:
+		p.Expr(expr.Name)
+		if expr.TypeVars != nil {
+			p.TypeVars(*expr.TypeVars)
+		}
+		p.tok(expr.Lparen)
+		for i, pair := range expr.Args {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.Expr(pair.First)
+		}
+		p.tok(expr.Rparen)
+	case parsetree.FuncDef:
+		p.FuncDef(expr)
+	case parsetree.Instantiation:
+		p.tok(expr.Name.Name)
+		p.TypeVars(expr.TypeVars)
+	default:
+		p.write(expr.String())
+	}
+}
+
+func (p *printer) StructLiteral(sl parsetree.StructLiteral) {
+	p.Type(sl.TypeName)
+	p.tok(sl.Lbrace)
+	if sl.Lbrace.Position().Line == sl.Rbrace.Position().Line || len(sl.Fields) == 0 {
+		for i, pair := range sl.Fields {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.StructLiteralField(pair.First)
+		}
+		p.tok(sl.Rbrace)
+		return
+	}
+
+	p.newline()
+	p.indent++
+	for _, pair := range sl.Fields {
+		p.StructLiteralField(pair.First)
+		if pair.Last != nil {
+			p.tok(*pair.Last)
+		} else {
+			p.write(",")
+		}
+		p.newline()
+	}
+	p.flushComments(sl.Rbrace.Position().Offset)
+	p.indent--
+	p.tok(sl.Rbrace)
+}
+
+// ListLiteral is laid out like a struct literal, with an element on every line if it spans several.
+func (p *printer) ListLiteral(ll parsetree.ListLiteral) {
+	commas := []*token.Token{}
+	for _, pair := range ll.Elems {
+		commas = append(commas, pair.Last)
+	}
+	p.Type(ll.TypeName)
+	p.elems(ll.Lbrace, ll.Rbrace, commas, func(i int) { p.Expr(ll.Elems[i].First) })
+}
+
+func (p *printer) MapLiteral(ml parsetree.MapLiteral) {
+	commas := []*token.Token{}
+	for _, pair := range ml.Entries {
+		commas = append(commas, pair.Last)
+	}
+	p.Type(ml.TypeName)
+	p.elems(ml.Lbrace, ml.Rbrace, commas, func(i int) {
+		entry := ml.Entries[i].First
+		p.Expr(entry.Key)
+		p.tok(entry.Colon)
+		p.space()
+		p.Expr(entry.Value)
+	})
+}
+
+// elems prints the braces of a list or map literal and the elements between them,
+// where elem prints the i-th element and commas are the commas after them.
+func (p *printer) elems(lbrace, rbrace token.Token, commas []*token.Token, elem func(i int)) {
+	p.tok(lbrace)
+	if lbrace.Position().Line == rbrace.Position().Line || len(commas) == 0 {
+		for i := range commas {
+			if i > 0 {
+				p.write(", ")
+			}
+			elem(i)
+		}
+		p.tok(rbrace)
+		return
+	}
+
+	p.newline()
+	p.indent++
+	for i, comma := range commas {
+		elem(i)
+		if comma != nil {
+			p.tok(*comma)
+		} else {
+			p.write(",")
+		}
+		p.newline()
+	}
+	p.flushComments(rbrace.Position().Offset)
+	p.indent--
+	p.tok(rbrace)
+}
+
+func (p *printer) StructLiteralField(field parsetree.StructLiteralField) {
+	p.tok(field.FieldName.Name)
+	p.tok(field.Colon)
+	p.space()
+	p.Expr(field.Value)
+}
+
+func (p *printer) FuncDef(fd parsetree.FuncDef) {
+	p.tok(fd.FuncKw)
+	p.funcRest(fd)
+}
+
+// funcRest prints a function after its `func` keyword, which methods share with their name before it.
+func (p *printer) funcRest(fd parsetree.FuncDef) {
+	if fd.TypeVars != nil {
+		p.TypeVars(*fd.TypeVars)
+	}
+	p.tok(fd.Lparen)
+	for i, pair := range fd.Args {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.tok(pair.First.Name.Name)
+		p.space()
+		p.Type(pair.First.Type)
+	}
+	p.tok(fd.Rparen)
+	if fd.ReturnType != nil {
+		p.space()
+		p.Type(*fd.ReturnType)
+	}
+	p.space()
+	p.tok(fd.Lbrace)
+	p.Stmts(fd.Body, fd.Rbrace)
+}
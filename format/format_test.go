@@ -0,0 +1,33 @@
+package format
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bigyihsuan/structlang/diag"
+)
+
+func TestSource(t *testing.T) {
+	got, err := Source("a.struct", "let a=1+2; // three\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "let a = 1 + 2; // three\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSourceIllegalCharacter(t *testing.T) {
+	src := "let a = 1;\nlet b = a ? 2;\n"
+	got, err := Source("a.struct", src)
+	var d diag.Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("got error %v, want a diagnostic", err)
+	}
+	if d.Message != "illegal character `?`" || d.Span.Start.Line != 2 || d.Span.Start.Column != 11 {
+		t.Errorf("got %s at %s, want an illegal character at a.struct:2:11", d.Message, d.Span.Start)
+	}
+	if got != src {
+		t.Errorf("got %q, want the source unchanged", got)
+	}
+}
@@ -10,6 +10,7 @@ type Lexer struct {
 	offset, line, column int
 	src                  []rune
 	lexeme               string
+	filename             string
 }
 
 func NewLexer(src any) (*Lexer, error) {
@@ -33,7 +34,16 @@ func NewLexer(src any) (*Lexer, error) {
 	}, nil
 }
 
+// SetFilename sets the file name in the position of every token lexed afterwards.
+func (l *Lexer) SetFilename(filename string) {
+	l.filename = filename
+}
+
 func (l *Lexer) Lex() token.Token {
+	return l.lex().InFile(l.filename)
+}
+
+func (l *Lexer) lex() token.Token {
 	if l.offset >= len(l.src) {
 		return token.NewToken(token.EOF, "EOF", l.offset, l.line, l.column)
 	}
@@ -77,6 +87,13 @@ func (l *Lexer) Lex() token.Token {
 		lexeme := l.resetLexeme()
 		return token.NewToken(token.ARROW, lexeme, offset, line, column)
 	}
+	// dotdot
+	if l.currentRune() == '.' && l.nextRune() == '.' {
+		l.addCurrent()
+		l.addCurrent()
+		lexeme := l.resetLexeme()
+		return token.NewToken(token.DOTDOT, lexeme, offset, line, column)
+	}
 	// gteq, lteq,
 	if l.currentRune() == '>' && l.nextRune() == '=' {
 		l.addCurrent()
@@ -121,16 +138,22 @@ func (l *Lexer) Lex() token.Token {
 		return token.NewToken(symbolTokenType, lexeme, offset, line, column)
 	}
 
-	return token.NewToken(token.ILLEGAL, string(l.currentRune()), offset, line, column)
+	// a rune that can't start a token is still consumed, so that lexing goes on after it
+	l.addCurrent()
+	lexeme := l.resetLexeme()
+	return token.NewToken(token.ILLEGAL, lexeme, offset, line, column)
 }
 
 func (l *Lexer) comment() {
-	l.addWhile(func(r rune) bool { return r != '\n' || l.offset >= len(l.src) })
-	l.nextLine()
+	l.addWhile(func(r rune) bool { return r != '\n' })
+	if l.offset < len(l.src) {
+		l.nextLine()
+	}
 }
 func (l *Lexer) intOrFloat() token.TokenType {
 	l.addWhile(isDigit)
-	if l.currentRune() != '.' {
+	if l.offset >= len(l.src) || l.currentRune() != '.' || l.nextRune() == '.' {
+		// `1..2` is a range, not the float `1.`
 		return token.INT
 	}
 	l.addCurrent()
@@ -139,11 +162,13 @@ func (l *Lexer) intOrFloat() token.TokenType {
 }
 func (l *Lexer) string() {
 	l.nextCol() // ignore first quote
-	for l.currentRune() != '"' {
+	for l.offset < len(l.src) && l.currentRune() != '"' {
 		if l.currentRune() == '\\' {
 			// escaped character
 			l.addCurrent() // backslash
-			l.addCurrent() // escaped char
+			if l.offset < len(l.src) {
+				l.addCurrent() // escaped char
+			}
 		} else {
 			l.addCurrent()
 		}
@@ -153,7 +178,7 @@ func (l *Lexer) string() {
 
 func (l Lexer) currentRune() rune { return l.src[l.offset] }
 func (l Lexer) nextRune() rune {
-	if l.offset >= len(l.src) {
+	if l.offset+1 >= len(l.src) {
 		return -1
 	}
 	return l.src[l.offset+1]
@@ -183,8 +208,8 @@ func (l *Lexer) addCurrent() {
 // add the current character to the lexeme if some condition is met.
 // returns the result of the predicate
 func (l *Lexer) addWhile(condition func(r rune) bool) bool {
-	ok := condition(l.currentRune())
-	for ; ok; ok = condition(l.currentRune()) {
+	ok := l.offset < len(l.src) && condition(l.currentRune())
+	for ; ok; ok = l.offset < len(l.src) && condition(l.currentRune()) {
 		l.addCurrent()
 	}
 	return ok
@@ -194,11 +219,15 @@ func isWhitespace(r rune) bool         { return unicode.IsSpace(r) }
 func isDigit(r rune) bool              { return unicode.IsDigit(r) }
 func isIdentOrKeywordChar(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
 
-func ClearComments(tokens []token.Token) (out []token.Token) {
+// ClearComments splits the comments out of tokens, so that the parser never sees them.
+// The comments are kept, in order, for tools like the formatter that put them back.
+func ClearComments(tokens []token.Token) (out []token.Token, comments []token.Token) {
 	for _, tok := range tokens {
 		if tok.Type() != token.COMMENT {
 			out = append(out, tok)
+		} else {
+			comments = append(comments, tok)
 		}
 	}
-	return out
+	return out, comments
 }
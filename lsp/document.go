@@ -0,0 +1,254 @@
+package lsp
+
+import (
+	"fmt"
+	gotoken "go/token"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/check"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/lexer"
+	"github.com/bigyihsuan/structlang/parser"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/ast"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// document is an open file, and what the checker found out about it.
+type document struct {
+	uri         string
+	lines       []string
+	info        *check.Info
+	diagnostics []Diagnostic
+}
+
+// analyze lexes, parses and checks text. Parsing recovers from syntax errors,
+// so the statements around a mistake are still checked.
+func analyze(uri, text string) *document {
+	doc := &document{uri: uri, lines: strings.Split(text, "\n"), diagnostics: []Diagnostic{}}
+
+	lex, _ := lexer.NewLexer(text)
+	lex.SetFilename(strings.TrimPrefix(uri, "file://"))
+	var tokens []token.Token
+	for tok := lex.Lex(); tok.Type() != token.EOF; tok = lex.Lex() {
+		if tok.Type() == token.ILLEGAL {
+			doc.report(diag.At(diag.SpanOf(&tok, &tok), "illegal character `%s`", tok.Lexeme()))
+			continue
+		}
+		tokens = append(tokens, tok)
+	}
+	tokens, _ = lexer.ClearComments(tokens)
+
+	p := parser.NewParser(tokens)
+	tree, err := p.Parse()
+	doc.report(err)
+
+	astparser := parser.NewAstParser(tree)
+	checker := check.NewChecker(astparser.Parse())
+	checker.Info = check.NewInfo()
+	doc.report(checker.Check(&checker.BaseScope))
+	doc.info = checker.Info
+	return doc
+}
+
+func (doc *document) report(err error) {
+	for _, e := range diag.Flatten(err) {
+		d, isDiag := e.(diag.Diagnostic)
+		if !isDiag {
+			d = diag.At(diag.Span{}, "%s", e)
+		}
+		message := d.Message
+		for _, note := range d.Notes {
+			message += "\nnote: " + note
+		}
+		severity := severityError
+		switch d.Severity {
+		case diag.Warning:
+			severity = severityWarning
+		case diag.Note:
+			severity = severityInformation
+		}
+		doc.diagnostics = append(doc.diagnostics, Diagnostic{
+			Range:    toRange(d.Span),
+			Severity: severity,
+			Source:   "structlang",
+			Message:  message,
+		})
+	}
+}
+
+func toPosition(pos gotoken.Position) Position {
+	if !pos.IsValid() {
+		return Position{}
+	}
+	return Position{Line: pos.Line - 1, Character: pos.Column - 1}
+}
+
+func toRange(span diag.Span) Range {
+	return Range{Start: toPosition(span.Start), End: toPosition(span.End)}
+}
+
+// contains reports whether pos is inside span, or at its end, where the cursor is after typing a name.
+func contains(span diag.Span, pos Position) bool {
+	r := toRange(span)
+	return !before(pos, r.Start) && !before(r.End, pos)
+}
+
+func before(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// defAt returns the definition of the name at pos, whether pos is on the definition or on a use.
+func (doc *document) defAt(pos Position) (ast.Ident, *check.Def) {
+	for _, use := range doc.info.Uses {
+		if contains(diag.NodeSpan(use.Ident), pos) {
+			return use.Ident, use.Def
+		}
+	}
+	for _, def := range doc.info.Defs {
+		if contains(diag.NodeSpan(def.Ident), pos) {
+			return def.Ident, def
+		}
+	}
+	return ast.Ident{}, nil
+}
+
+// hover describes the type of the variable or type at pos.
+func (doc *document) hover(pos Position) *Hover {
+	ident, def := doc.defAt(pos)
+	if def == nil {
+		return nil
+	}
+	var text string
+	if def.IsType() {
+		text = fmt.Sprintf("type %s = %s", TypeName{Name: def.Ident.Name, Vars: def.Struct.Vars}, def.Struct)
+	} else {
+		text = fmt.Sprintf("%s %s", def.Ident.Name, def.Type)
+	}
+	r := toRange(diag.NodeSpan(ident))
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```structlang\n" + text + "\n```"},
+		Range:    &r,
+	}
+}
+
+// definition finds the `let`, `type`, argument or match binding that defines the name at pos.
+func (doc *document) definition(pos Position) *Location {
+	_, def := doc.defAt(pos)
+	if def == nil {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: toRange(diag.NodeSpan(def.Ident))}
+}
+
+// visible returns the definition of name that can be seen at pos, if there is one.
+func (doc *document) visible(name string, isType bool, pos Position) *check.Def {
+	var found *check.Def
+	for _, def := range doc.info.Defs {
+		if def.Ident.Name != name || def.IsType() != isType {
+			continue
+		}
+		if span, ok := doc.info.Scopes[def.Scope]; ok && !contains(span, pos) {
+			continue
+		}
+		at := toPosition(diag.NodeSpan(def.Ident).Start)
+		if !isType && before(pos, at) {
+			continue
+		}
+		// later and more deeply nested definitions shadow earlier ones
+		if found == nil || before(toPosition(diag.NodeSpan(found.Ident).Start), at) {
+			found = def
+		}
+	}
+	return found
+}
+
+var accessChain = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*(?:\s*->\s*[A-Za-z_][A-Za-z0-9_]*)*)\s*->\s*[A-Za-z0-9_]*$`)
+
+// completion offers the fields of the value before the `->` at pos.
+// The line being typed usually doesn't parse yet, so the receiver is read from the text
+// and its type is found from the definitions around it.
+func (doc *document) completion(pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	if pos.Line >= len(doc.lines) {
+		return items
+	}
+	line := []rune(doc.lines[pos.Line])
+	if pos.Character > len(line) {
+		return items
+	}
+	match := accessChain.FindStringSubmatch(string(line[:pos.Character]))
+	if match == nil {
+		return items
+	}
+	names := strings.Split(match[1], "->")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+
+	def := doc.visible(names[0], false, pos)
+	if def == nil {
+		return items
+	}
+	ty := def.Type
+	for _, field := range names[1:] {
+		fields := doc.fields(ty, pos)
+		next, ok := fields[field]
+		if !ok {
+			return items
+		}
+		ty = next
+	}
+
+	fields := doc.fields(ty, pos)
+	for name, fieldType := range fields {
+		items = append(items, CompletionItem{Label: name, Kind: completionItemField, Detail: fieldType.String()})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// fields returns the fields of a value of type ty, with the type's parameters filled in.
+func (doc *document) fields(ty TypeName, pos Position) map[string]TypeName {
+	return doc.structFields(ty, pos, map[string]bool{})
+}
+
+// structFields is fields, skipping the types in seen so that types that embed each other still end.
+func (doc *document) structFields(ty TypeName, pos Position, seen map[string]bool) map[string]TypeName {
+	seen[ty.Name] = true
+	if prim, isPrimitive := builtin.Primitives[ty.Name]; isPrimitive {
+		return prim.Fields
+	}
+	if ty.IsFunc() {
+		return map[string]TypeName{}
+	}
+	def := doc.visible(ty.Name, true, pos)
+	if def == nil {
+		// eithers, lists and maps have the same fields as primitives, with `v` being the value itself
+		return map[string]TypeName{
+			"v":    ty,
+			"name": {Name: "string"},
+			"len":  {Name: "int"},
+		}
+	}
+	params := def.Struct.Params(ty.Vars)
+	fields := make(map[string]TypeName)
+	for name, fieldType := range def.Struct.Fields {
+		fields[name] = fieldType.Substitute(params)
+	}
+	// promoted fields, unless a field of the outer struct hides them
+	for _, embedded := range def.Struct.Embedded {
+		if seen[embedded] {
+			continue
+		}
+		for name, fieldType := range doc.structFields(fields[embedded], pos, seen) {
+			if _, hidden := fields[name]; !hidden {
+				fields[name] = fieldType
+			}
+		}
+	}
+	return fields
+}
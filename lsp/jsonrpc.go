@@ -0,0 +1,89 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// Message is a JSON-RPC 2.0 request, response or notification.
+// Requests have an ID and a Method, notifications only a Method, and responses only an ID.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// ParseError is the error of a message that was read but can't be used,
+// because its `Content-Length` or its body is invalid. The messages after it can still be read.
+type ParseError struct {
+	err error
+}
+
+func (e ParseError) Error() string { return e.err.Error() }
+func (e ParseError) Unwrap() error { return e.err }
+
+// ReadMessage reads one message framed by a `Content-Length` header, as LSP sends them.
+func ReadMessage(r *bufio.Reader) (msg Message, err error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return msg, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return msg, ParseError{fmt.Errorf("bad Content-Length: %w", err)}
+	} else if length < 0 {
+		return msg, ParseError{fmt.Errorf("bad Content-Length: %d", length)}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return msg, ParseError{err}
+	}
+	return msg, nil
+}
+
+// WriteMessage writes msg framed by a `Content-Length` header.
+func WriteMessage(w io.Writer, msg Message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// Request builds a request, or a notification if id is nil.
+func Request(id any, method string, params any) (Message, error) {
+	msg := Message{Method: method}
+	if id != nil {
+		raw, err := json.Marshal(id)
+		if err != nil {
+			return msg, err
+		}
+		msg.ID = (*json.RawMessage)(&raw)
+	}
+	raw, err := json.Marshal(params)
+	msg.Params = raw
+	return msg, err
+}
@@ -0,0 +1,154 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Server is a language server for .struct files. It reads requests from In and writes responses
+// and notifications to Out, so an editor can run it over stdio and a test can drive it through pipes.
+//
+// Diagnostics come from the lexer, the parser and the checker. The evaluator is never run,
+// since the code being edited may loop forever or print.
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// Run handles messages until the client sends `exit` or closes In.
+func (s *Server) Run() error {
+	for {
+		msg, err := ReadMessage(s.in)
+		var parseErr ParseError
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if errors.As(err, &parseErr) {
+			// the id of a message that can't be parsed isn't known, so the response has a null one
+			null := json.RawMessage("null")
+			response := Message{ID: &null, Error: &ResponseError{Code: codeParseError, Message: parseErr.Error()}}
+			if err := WriteMessage(s.out, response); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg Message) error {
+	var result any
+	var rerr *ResponseError
+	switch msg.Method {
+	case "initialize":
+		result = InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:   textDocumentSyncFull,
+				HoverProvider:      true,
+				DefinitionProvider: true,
+				CompletionProvider: &CompletionOptions{TriggerCharacters: []string{">"}},
+			},
+			ServerInfo: ServerInfo{Name: "structlang"},
+		}
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil {
+			return s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil && len(params.ContentChanges) > 0 {
+			changes := params.ContentChanges
+			return s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil {
+			delete(s.docs, params.TextDocument.URI)
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil {
+			if doc, ok := s.docs[params.TextDocument.URI]; ok {
+				if hover := doc.hover(params.Position); hover != nil {
+					result = hover
+				}
+			}
+		}
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil {
+			if doc, ok := s.docs[params.TextDocument.URI]; ok {
+				if loc := doc.definition(params.Position); loc != nil {
+					result = loc
+				}
+			}
+		}
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if rerr = unmarshal(msg.Params, &params); rerr == nil {
+			items := []CompletionItem{}
+			if doc, ok := s.docs[params.TextDocument.URI]; ok {
+				items = doc.completion(params.Position)
+			}
+			result = items
+		}
+	default:
+		if msg.ID != nil {
+			rerr = &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+		}
+	}
+
+	if msg.ID == nil {
+		// notifications don't get responses
+		return nil
+	}
+	response := Message{ID: msg.ID, Error: rerr}
+	if rerr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = raw
+	}
+	return WriteMessage(s.out, response)
+}
+
+func unmarshal(params json.RawMessage, v any) *ResponseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// update analyzes the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	doc := analyze(uri, text)
+	s.docs[uri] = doc
+	notification, err := Request(nil, "textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics})
+	if err != nil {
+		return err
+	}
+	return WriteMessage(s.out, notification)
+}
@@ -0,0 +1,234 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client drives a Server through pipes, like an editor does over stdio.
+type client struct {
+	t    *testing.T
+	in   io.Writer
+	out  *bufio.Reader
+	done chan error
+	id   int
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) send(id any, method string, params any) {
+	c.t.Helper()
+	msg, err := Request(id, method, params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := WriteMessage(c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads the next message from the server, failing if there is none within a second.
+func (c *client) receive() Message {
+	c.t.Helper()
+	received := make(chan Message, 1)
+	failed := make(chan error, 1)
+	go func() {
+		msg, err := ReadMessage(c.out)
+		if err != nil {
+			failed <- err
+			return
+		}
+		received <- msg
+	}()
+	select {
+	case msg := <-received:
+		return msg
+	case err := <-failed:
+		c.t.Fatal(err)
+	case <-time.After(time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return Message{}
+}
+
+// request sends a request and decodes the result of its response into result.
+func (c *client) request(method string, params any, result any) {
+	c.t.Helper()
+	c.id++
+	c.send(c.id, method, params)
+	msg := c.receive()
+	if msg.Error != nil {
+		c.t.Fatalf("%s: %s", method, msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("%s: %s", method, err)
+	}
+}
+
+// open opens a document and returns the diagnostics published for it.
+func (c *client) open(uri, text string) []Diagnostic {
+	c.t.Helper()
+	c.send(nil, "textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "structlang", Text: text}})
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got %q, want diagnostics", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params.Diagnostics
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+const pointSrc = `type point = struct{x,y int};
+let p = point{x: 1, y: 2};
+println(p->x);
+`
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	var init InitializeResult
+	c.request("initialize", struct{}{}, &init)
+	if !init.Capabilities.HoverProvider || !init.Capabilities.DefinitionProvider {
+		t.Errorf("missing capabilities: %+v", init.Capabilities)
+	}
+	c.send(nil, "initialized", struct{}{})
+
+	uri := "file:///point.struct"
+	if diags := c.open(uri, pointSrc); len(diags) != 0 {
+		t.Errorf("got diagnostics %+v, want none", diags)
+	}
+
+	var hover Hover
+	c.request("textDocument/hover", at(uri, 2, 8), &hover)
+	if !strings.Contains(hover.Contents.Value, "p point") {
+		t.Errorf("got hover %q, want the type of p", hover.Contents.Value)
+	}
+
+	var loc Location
+	c.request("textDocument/definition", at(uri, 2, 8), &loc)
+	if want := (Position{Line: 1, Character: 4}); loc.URI != uri || loc.Range.Start != want {
+		t.Errorf("got definition %+v, want %s at %+v", loc, uri, want)
+	}
+
+	var items []CompletionItem
+	c.request("textDocument/completion", at(uri, 2, 11), &items)
+	labels := []string{}
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	if got, want := strings.Join(labels, ","), "x,y"; got != want {
+		t.Errorf("got completions %s, want %s", got, want)
+	}
+
+	c.request("shutdown", nil, &struct{}{})
+	c.send(nil, "exit", nil)
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerIllegalCharacter(t *testing.T) {
+	c := newClient(t)
+	uri := "file:///illegal.struct"
+	diags := c.open(uri, "let a = 1 ? 2;\n"+pointSrc)
+	found := false
+	for _, d := range diags {
+		if strings.Contains(d.Message, "illegal character `?`") {
+			found = true
+			if want := (Position{Line: 0, Character: 10}); d.Range.Start != want {
+				t.Errorf("got illegal character at %+v, want %+v", d.Range.Start, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("got diagnostics %+v, want an illegal character", diags)
+	}
+
+	// the server keeps answering, and the rest of the document is still checked
+	var hover Hover
+	c.request("textDocument/hover", at(uri, 3, 8), &hover)
+	if !strings.Contains(hover.Contents.Value, "p point") {
+		t.Errorf("got hover %q, want the type of p", hover.Contents.Value)
+	}
+}
+
+func TestServerParseError(t *testing.T) {
+	c := newClient(t)
+	uri := "file:///point.struct"
+	c.open(uri, pointSrc)
+	for _, raw := range []string{"Content-Length: -1\r\n\r\n", "Content-Length: 5\r\n\r\n{bad}"} {
+		if _, err := io.WriteString(c.in, raw); err != nil {
+			t.Fatal(err)
+		}
+		msg := c.receive()
+		if msg.Error == nil || msg.Error.Code != codeParseError {
+			t.Errorf("got %+v for %q, want a parse error", msg, raw)
+		}
+	}
+
+	// the server keeps answering after the messages it couldn't parse
+	var hover Hover
+	c.request("textDocument/hover", at(uri, 2, 8), &hover)
+	if !strings.Contains(hover.Contents.Value, "p point") {
+		t.Errorf("got hover %q, want the type of p", hover.Contents.Value)
+	}
+}
+
+func TestServerCompletionInBrokenFunc(t *testing.T) {
+	c := newClient(t)
+	for name, src := range map[string]string{
+		"field access before the closing brace": `type point = struct{x,y int};
+let f = func(q point) int {
+    let r = q;
+    q->
+};
+`,
+		"body that isn't closed yet": `type point = struct{x,y int};
+let f = func(q point) int {
+    let r = q;
+    q->`,
+	} {
+		uri := "file:///" + strings.ReplaceAll(name, " ", "-") + ".struct"
+		for _, d := range c.open(uri, src) {
+			if strings.Contains(d.Message, "missing return") {
+				t.Errorf("%s: got diagnostic %q, want only the syntax error", name, d.Message)
+			}
+		}
+		// both the argument and the local variable of the function are known
+		for _, receiver := range []string{"q", "r"} {
+			var items []CompletionItem
+			c.send(nil, "textDocument/didChange", DidChangeTextDocumentParams{
+				TextDocument:   VersionedTextDocumentIdentifier{URI: uri},
+				ContentChanges: []TextDocumentContentChangeEvent{{Text: strings.Replace(src, "q->", receiver+"->", 1)}},
+			})
+			c.receive()
+			c.request("textDocument/completion", at(uri, 3, 7), &items)
+			labels := []string{}
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if got, want := strings.Join(labels, ","), "x,y"; got != want {
+				t.Errorf("%s: got completions %s for %s, want %s", name, got, receiver, want)
+			}
+		}
+	}
+}
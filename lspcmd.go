@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/bigyihsuan/structlang/lsp"
+)
+
+// lspCommand is the `lsp` subcommand, which runs a language server over stdio.
+type lspCommand struct{}
+
+func (c *lspCommand) Execute(args []string) error {
+	return lsp.NewServer(os.Stdin, os.Stdout).Run()
+}
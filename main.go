@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/bigyihsuan/structlang/check"
+	"github.com/bigyihsuan/structlang/compile"
+	"github.com/bigyihsuan/structlang/diag"
 	"github.com/bigyihsuan/structlang/eval"
 	"github.com/bigyihsuan/structlang/lexer"
 	"github.com/bigyihsuan/structlang/parser"
+	"github.com/bigyihsuan/structlang/repl"
 	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/vm"
 	"github.com/jessevdk/go-flags"
 	"github.com/kr/pretty"
 )
@@ -18,20 +23,43 @@ const srcTemplate = `"""
 
 func main() {
 	var opts struct {
-		File  flags.Filename `short:"f" long:"file" value-name:"FILE" description:"Input code file."`
-		Code  flags.Filename `short:"c" long:"code" value-name:"CODE" description:"Argument-provided code."`
-		Debug bool           `short:"d" long:"debug" description:"Output debugging information."`
+		File    flags.Filename `short:"f" long:"file" value-name:"FILE" description:"Input code file."`
+		Code    flags.Filename `short:"c" long:"code" value-name:"CODE" description:"Argument-provided code."`
+		Debug   bool           `short:"d" long:"debug" description:"Output debugging information."`
+		NoCheck bool           `long:"no-check" description:"Skip static type checking before evaluation."`
+		VM      bool           `long:"vm" description:"Compile to bytecode and run it on the VM instead of the tree-walking evaluator."`
+		Repl    bool           `short:"r" long:"repl" description:"Start an interactive session. This is the default when no code is given."`
 	}
-	_, err := flags.Parse(&opts)
+	flagParser := flags.NewParser(&opts, flags.Default)
+	flagParser.SubcommandsOptional = true
+	flagParser.AddCommand("fmt", "Format code", "Reprint code in canonical style, keeping its comments.", &fmtCommand{})
+	flagParser.AddCommand("lsp", "Run a language server", "Speak the Language Server Protocol over stdin and stdout.", &lspCommand{})
+	_, err := flagParser.Parse()
 	if err != nil {
 		os.Exit(1)
 	}
+	if flagParser.Active != nil {
+		// the subcommand already ran
+		return
+	}
 
 	if opts.File != "" && opts.Code != "" {
 		fmt.Fprintln(os.Stderr, "-f/--file and -c/--code flags are mutually exclusive")
 		os.Exit(1)
 	}
 
+	if opts.Repl || (opts.File == "" && opts.Code == "") {
+		if opts.VM {
+			fmt.Fprintln(os.Stderr, "the repl always uses the tree-walking evaluator, ignoring --vm")
+		}
+		r := repl.NewRepl(os.Stdin, os.Stdout, os.Stderr, opts.NoCheck)
+		if err := r.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var src string
 
 	if opts.File != "" {
@@ -47,6 +75,7 @@ func main() {
 	src += "\n"
 
 	lex, _ := lexer.NewLexer(src)
+	lex.SetFilename(string(opts.File))
 	if opts.Debug {
 		fmt.Printf(srcTemplate, src)
 		fmt.Println()
@@ -59,7 +88,7 @@ func main() {
 		tok = lex.Lex()
 	}
 
-	tokens = lexer.ClearComments(tokens)
+	tokens, _ = lexer.ClearComments(tokens)
 
 	if opts.Debug {
 		for _, tok := range tokens {
@@ -78,7 +107,7 @@ func main() {
 		}
 	}
 	if errs != nil {
-		fmt.Fprintln(os.Stderr, errs)
+		diag.Render(os.Stderr, src, errs)
 		return
 	}
 
@@ -89,22 +118,45 @@ func main() {
 		fmt.Println()
 	}
 
+	if !opts.NoCheck {
+		checker := check.NewChecker(asttree)
+		err = checker.Check(&checker.BaseScope)
+		if err != nil {
+			diag.Render(os.Stderr, src, err)
+			return
+		}
+	}
+
+	if opts.VM {
+		compiler := compile.NewCompiler(asttree)
+		prog, err := compiler.Compile()
+		if err != nil {
+			diag.Render(os.Stderr, src, err)
+			return
+		}
+		if opts.Debug {
+			fmt.Println(prog)
+		}
+		machine := vm.NewVM(prog)
+		err = machine.Run()
+		if err != nil {
+			diag.Render(os.Stderr, src, err)
+		}
+		return
+	}
+
 	evaluator := eval.NewEvaluator(asttree)
 	_, err = evaluator.Evaluate(&evaluator.BaseEnv)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		diag.Render(os.Stderr, src, err)
 		return
 	}
 	// pretty.Println(evaluator.BaseEnv)
 	if opts.Debug {
 		fmt.Println("types:\n=======")
-		for id, ty := range evaluator.BaseEnv.Types {
-			fmt.Printf("%s = %s\n", id, ty.String())
-		}
+		evaluator.BaseEnv.DumpTypes(os.Stdout)
 		fmt.Println()
 		fmt.Println("vars:\n=======")
-		for id, val := range evaluator.BaseEnv.Variables {
-			fmt.Printf("%s %s = %v\n", id, val.TypeName(), val)
-		}
+		evaluator.BaseEnv.DumpVariables(os.Stdout)
 	}
 }
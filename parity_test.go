@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bigyihsuan/structlang/check"
+	"github.com/bigyihsuan/structlang/compile"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/eval"
+	"github.com/bigyihsuan/structlang/lexer"
+	"github.com/bigyihsuan/structlang/parser"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/ast"
+	"github.com/bigyihsuan/structlang/vm"
+)
+
+// parse lexes and parses src into statements.
+func parse(src string) ([]ast.Stmt, error) {
+	lex, _ := lexer.NewLexer(src)
+	var tokens []token.Token
+	for tok := lex.Lex(); tok.Type() != token.EOF; tok = lex.Lex() {
+		tokens = append(tokens, tok)
+	}
+	tokens, _ = lexer.ClearComments(tokens)
+	p := parser.NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	astparser := parser.NewAstParser(tree)
+	return astparser.Parse(), nil
+}
+
+// checkProgram checks stmts like main does.
+func checkProgram(stmts []ast.Stmt) error {
+	checker := check.NewChecker(stmts)
+	return checker.Check(&checker.BaseScope)
+}
+
+// run runs src like main does, and returns what it printed followed by its errors.
+func run(t *testing.T, src string, useVM, noCheck bool) string {
+	t.Helper()
+	printed, errs := output(t, src, useVM, noCheck)
+	return printed + errs
+}
+
+// output runs src like main does, and returns what it printed and its rendered errors.
+func output(t *testing.T, src string, useVM, noCheck bool) (printed, errs string) {
+	t.Helper()
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	stdoutc := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		stdoutc <- b
+	}()
+
+	var rendered bytes.Buffer
+	func() {
+		defer func() { os.Stdout = stdout }()
+		stmts, err := parse(src)
+		if err != nil {
+			diag.Render(&rendered, src, err)
+			return
+		}
+		if !noCheck {
+			if err := checkProgram(stmts); err != nil {
+				diag.Render(&rendered, src, err)
+				return
+			}
+		}
+		if useVM {
+			compiler := compile.NewCompiler(stmts)
+			prog, err := compiler.Compile()
+			if err != nil {
+				diag.Render(&rendered, src, err)
+				return
+			}
+			machine := vm.NewVM(prog)
+			err = machine.Run()
+			diag.Render(&rendered, src, err)
+			return
+		}
+		evaluator := eval.NewEvaluator(stmts)
+		_, err = evaluator.Evaluate(&evaluator.BaseEnv)
+		diag.Render(&rendered, src, err)
+	}()
+	w.Close()
+	return string(<-stdoutc), rendered.String()
+}
+
+// errorPrograms fail at runtime, where both engines must stop the same statements.
+var errorPrograms = map[string]string{
+	"error in func body": `let f = func() nil { let z = 0; println(1 / z); println("after"); };
+f();
+println("x");`,
+	"error in block": `let i = 0;
+while i < 3 {
+    set i = i + 1;
+    if i = 2 {
+        println(1 / (i - 2));
+        println("after");
+    }
+    println(i);
+}
+println("x");`,
+	"error in nested call": `let inner = func(xs list[int]) int { return xs->[5]; };
+let outer = func() int { let n = inner(list[int]{1}); println("after"); return n; };
+println(outer());
+println("x");`,
+	"error in match arm": `let e = parseInt("x");
+match e {
+    n int { println(n); }
+    s string { println(substring(s, 5, 1)); println("after"); }
+}
+println("x");`,
+	"error in for loop": `for i in 0..3 {
+    println(pow(2, i - 1));
+}
+println("x");`,
+	"hoisted function called before its let": `let g = func() int { return k(); };
+println(g());
+let k = func() int { return 3; };
+println(g());`,
+	"unbounded recursion": `let f = func(n int) int { return f(n + 1); };
+println(f(0));
+println("x");`,
+	"deep recursion": `let f = func(n int) int { if n = 0 { return 0; } return 1 + f(n - 1); };
+println(f(9999));
+println(f(10000));
+println("x");`,
+	"several errors": `println(int(0.0 / 0.0));
+println("between");
+println(repeat("a", -1));
+println("x");`,
+}
+
+// uncheckedPrograms only fail when the checker is skipped.
+var uncheckedPrograms = map[string]string{
+	"bad set in func body": `let y = 1;
+let f = func() int { set y = "s"; println("after"); return 1; };
+f();
+println("x");`,
+	"break outside of a loop": `if true { break; println("after"); }
+println("x");`,
+	"continue in func body": `let f = func() nil { continue; println("after"); };
+f();
+println("x");`,
+	"undefined names": `let f = func() nil { nope(); println("after"); };
+f();
+set missing = 1;
+println(missing);
+println("x");`,
+	"mixed numbers": `let f = func() nil { println(1 + 1.5); println("after"); };
+f();
+println(1 + "a");
+println("x");`,
+}
+
+// scopePrograms print want in both engines, with or without the checker,
+// since a function sees the variables that were declared where it was defined.
+var scopePrograms = map[string]struct{ src, want string }{
+	"capture before a later let": {`let y = 100;
+let outer = func() int {
+    let g = func() int { return y; };
+    let y = 5;
+    return g() + y;
+};
+println(outer());`, "105\n"},
+	"capture in a block before a later let": {`let y = 1;
+let outer = func() int {
+    let g = func() int { return 0; };
+    if true {
+        set g = func() int { return y; };
+    }
+    let y = 2;
+    return g();
+};
+println(outer());`, "1\n"},
+	"redefinition seen by a closure": {`let outer = func() int {
+    let y = 1;
+    let g = func() int { return y; };
+    let y = 2;
+    return g();
+};
+println(outer());`, "2\n"},
+	"hoisted functions": {`let outer = func() int {
+    let even = func(n int) bool { if n = 0 { return true; } return odd(n - 1); };
+    let odd = func(n int) bool { if n = 0 { return false; } return even(n - 1); };
+    if even(10) { return 1; }
+    return 0;
+};
+println(outer());`, "1\n"},
+}
+
+func TestEnginesAgreeOnScopes(t *testing.T) {
+	for name, program := range scopePrograms {
+		t.Run(name, func(t *testing.T) {
+			for _, noCheck := range []bool{false, true} {
+				walked, compiled := run(t, program.src, false, noCheck), run(t, program.src, true, noCheck)
+				if walked != program.want || compiled != program.want {
+					t.Errorf("with noCheck %v, got evaluator:\n%s\nvm:\n%s\nwant:\n%s", noCheck, walked, compiled, program.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnginesAgreeOnErrors(t *testing.T) {
+	for name, src := range errorPrograms {
+		t.Run(name, func(t *testing.T) {
+			walked, compiled := run(t, src, false, false), run(t, src, true, false)
+			if walked != compiled {
+				t.Errorf("evaluator:\n%s\nvm:\n%s", walked, compiled)
+			}
+			if strings.Contains("\n"+walked, "\nafter\n") {
+				t.Errorf("the statement after an error ran:\n%s", walked)
+			}
+		})
+	}
+	for name, src := range uncheckedPrograms {
+		t.Run(name, func(t *testing.T) {
+			walked, compiled := run(t, src, false, true), run(t, src, true, true)
+			if walked != compiled {
+				t.Errorf("evaluator:\n%s\nvm:\n%s", walked, compiled)
+			}
+			if strings.Contains("\n"+walked, "\nafter\n") {
+				t.Errorf("the statement after an error ran:\n%s", walked)
+			}
+		})
+	}
+}
+
+func TestEnginesAgreeOnExamples(t *testing.T) {
+	files, err := filepath.Glob("example/*.struct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(file, func(t *testing.T) {
+			walked, compiled := run(t, string(src), false, false), run(t, string(src), true, false)
+			if walked != compiled {
+				t.Errorf("evaluator:\n%s\nvm:\n%s", walked, compiled)
+			}
+		})
+	}
+}
+
+// TestShouldErrorExamples checks that the checker rejects every program in example/should-error,
+// so that none of them runs in either engine.
+func TestShouldErrorExamples(t *testing.T) {
+	files, err := filepath.Glob("example/should-error/*.struct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(file, func(t *testing.T) {
+			stmts, err := parse(string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diags := diag.Flatten(checkProgram(stmts)); len(diags) == 0 {
+				t.Errorf("got no diagnostics, want the checker to reject it")
+			}
+			for _, useVM := range []bool{false, true} {
+				if printed, _ := output(t, string(src), useVM, false); printed != "" {
+					t.Errorf("with useVM %v, got output:\n%s\nwant none", useVM, printed)
+				}
+			}
+		})
+	}
+}
@@ -28,15 +28,20 @@ func (a AstParser) Stmt(stmt parsetree.Stmt) (s ast.Stmt) {
 	switch stmt := stmt.(type) {
 	case parsetree.TypeDef:
 		typename := a.Type(stmt.TypeName)
-		structdef := a.StructDef(stmt.StructDef)
-		return ast.TypeDef{
-			Type:      typename,
-			StructDef: structdef,
+		td := ast.TypeDef{
+			Type: typename,
 			Tokens: ast.Tokens{
 				FirstToken: &stmt.TypeKw,
 				LastToken:  &stmt.Sc,
 			},
 		}
+		if stmt.Alias != nil {
+			alias := a.Type(*stmt.Alias)
+			td.Alias = &alias
+		} else {
+			td.StructDef = a.StructDef(stmt.StructDef)
+		}
+		return td
 	case parsetree.VarDef:
 		lvalue := a.Lvalue(stmt.Lvalue)
 		rvalue := a.Expr(stmt.Rvalue)
@@ -71,6 +76,50 @@ func (a AstParser) Stmt(stmt parsetree.Stmt) (s ast.Stmt) {
 				LastToken:  &stmt.Sc,
 			},
 		}
+	case parsetree.IfStmt:
+		return a.IfStmt(stmt)
+	case parsetree.WhileStmt:
+		return ast.WhileStmt{
+			Cond: a.Expr(stmt.Cond),
+			Body: a.Block(stmt.Body),
+			Tokens: ast.Tokens{
+				FirstToken: &stmt.WhileKw,
+				LastToken:  &stmt.Body.Rbrace,
+			},
+		}
+	case parsetree.ForStmt:
+		return a.ForStmt(stmt)
+	case parsetree.BreakStmt:
+		return ast.BreakStmt{Tokens: ast.Tokens{FirstToken: &stmt.BreakKw, LastToken: &stmt.Sc}}
+	case parsetree.ContinueStmt:
+		return ast.ContinueStmt{Tokens: ast.Tokens{FirstToken: &stmt.ContinueKw, LastToken: &stmt.Sc}}
+	case parsetree.MatchStmt:
+		arms := []ast.MatchArm{}
+		for _, arm := range stmt.Arms {
+			arms = append(arms, a.MatchArm(arm))
+		}
+		return ast.MatchStmt{
+			Subject: a.Expr(stmt.Subject),
+			Arms:    arms,
+			Tokens: ast.Tokens{
+				FirstToken: &stmt.MatchKw,
+				LastToken:  &stmt.Rbrace,
+			},
+		}
+	case parsetree.MethodDef:
+		receiver := ast.FuncArg{Name: a.Ident(stmt.Receiver.Name), Type: a.Type(stmt.Receiver.Type)}
+		fd := a.FuncDef(stmt.Func).(ast.FuncDef)
+		fd.Args = append([]ast.FuncArg{receiver}, fd.Args...)
+		fd.TypeParams = append(append([]ast.Type{}, receiver.Type.Vars...), fd.TypeParams...)
+		return ast.MethodDef{
+			Receiver: receiver,
+			Name:     a.Ident(stmt.Name),
+			Func:     fd,
+			Tokens: ast.Tokens{
+				FirstToken: &stmt.FuncKw,
+				LastToken:  &stmt.Func.Rbrace,
+			},
+		}
 	case parsetree.ExprStmt:
 		expr := a.Expr(stmt.Expr)
 		return ast.ExprStmt{
@@ -85,23 +134,95 @@ func (a AstParser) Stmt(stmt parsetree.Stmt) (s ast.Stmt) {
 	return
 }
 
+func (a AstParser) IfStmt(stmt parsetree.IfStmt) ast.IfStmt {
+	is := ast.IfStmt{
+		Cond: a.Expr(stmt.Cond),
+		Then: a.Block(stmt.Then),
+		Tokens: ast.Tokens{
+			FirstToken: &stmt.IfKw,
+			LastToken:  &stmt.Then.Rbrace,
+		},
+	}
+	if stmt.Else == nil {
+		return is
+	}
+	if stmt.Else.If != nil {
+		elseIf := a.IfStmt(*stmt.Else.If)
+		is.Else = &ast.Block{
+			Stmts: []ast.Stmt{elseIf},
+			Tokens: ast.Tokens{
+				FirstToken: &stmt.Else.ElseKw,
+				LastToken:  elseIf.LastToken,
+			},
+		}
+	} else {
+		block := a.Block(*stmt.Else.Block)
+		is.Else = &block
+	}
+	is.LastToken = is.Else.LastToken
+	return is
+}
+
+func (a AstParser) ForStmt(stmt parsetree.ForStmt) ast.ForStmt {
+	fs := ast.ForStmt{
+		Elem:     a.Ident(stmt.Elem),
+		Iterable: a.Expr(stmt.Iterable),
+		Body:     a.Block(stmt.Body),
+		Tokens: ast.Tokens{
+			FirstToken: &stmt.ForKw,
+			LastToken:  &stmt.Body.Rbrace,
+		},
+	}
+	if stmt.Index != nil {
+		index := a.Ident(*stmt.Index)
+		fs.Index = &index
+	}
+	if stmt.End != nil {
+		fs.End = a.Expr(stmt.End)
+	}
+	return fs
+}
+
+func (a AstParser) MatchArm(arm parsetree.MatchArm) ast.MatchArm {
+	ty := a.Type(arm.Type)
+	ma := ast.MatchArm{
+		Type: ty,
+		Body: a.Block(arm.Body),
+		Tokens: ast.Tokens{
+			FirstToken: ty.FirstToken,
+			LastToken:  &arm.Body.Rbrace,
+		},
+	}
+	if arm.Binding != nil {
+		binding := a.Ident(*arm.Binding)
+		ma.Binding = &binding
+		ma.FirstToken = binding.FirstToken
+	}
+	return ma
+}
+
+func (a AstParser) Block(block parsetree.Block) ast.Block {
+	stmts := []ast.Stmt{}
+	for _, stmt := range block.Stmts {
+		stmts = append(stmts, a.Stmt(stmt))
+	}
+	return ast.Block{
+		Stmts: stmts,
+		Tokens: ast.Tokens{
+			FirstToken: &block.Lbrace,
+			LastToken:  &block.Rbrace,
+		},
+	}
+}
+
 func (a AstParser) Lvalue(lv parsetree.Lvalue) (l ast.Lvalue) {
 	switch lv := lv.(type) {
 	case parsetree.Ident:
 		return a.Ident(lv)
 	case parsetree.FieldAccess:
-		lvalue := a.Lvalue(lv.Lvalue)
-		ident := a.Ident(lv.Field)
-		firsttoken := lvalue.FirstTok()
-		lasttoken := ident.LastToken
-		return ast.FieldAccess{
-			Lvalue: lvalue,
-			Field:  ident,
-			Tokens: ast.Tokens{
-				FirstToken: firsttoken,
-				LastToken:  lasttoken,
-			},
-		}
+		return a.FieldAccess(lv)
+	case parsetree.Index:
+		return a.Index(lv)
 	default:
 		fmt.Printf("ast unknown ast %T\n", lv)
 	}
@@ -131,7 +252,25 @@ func (a AstParser) Expr(expr parsetree.Expr) (e ast.Expr) {
 			},
 		}
 	case parsetree.StructLiteral:
+		switch expr.TypeName.TypeName.Name.Lexeme() {
+		case "list":
+			if len(expr.Fields) == 0 {
+				// `list[T]{}` has no elements to tell it apart from a struct literal
+				return a.ListLiteral(parsetree.ListLiteral{TypeName: expr.TypeName, Lbrace: expr.Lbrace, Rbrace: expr.Rbrace})
+			}
+		case "map":
+			if len(expr.Fields) == 0 {
+				// nor does `map[K,V]{}`
+				return a.MapLiteral(parsetree.MapLiteral{TypeName: expr.TypeName, Lbrace: expr.Lbrace, Rbrace: expr.Rbrace})
+			}
+		}
 		return a.StructLiteral(expr)
+	case parsetree.ListLiteral:
+		return a.ListLiteral(expr)
+	case parsetree.MapLiteral:
+		return a.MapLiteral(expr)
+	case parsetree.Index:
+		return a.Index(expr)
 	case parsetree.Ident:
 		return a.Ident(expr)
 	case parsetree.FieldAccess:
@@ -146,6 +285,27 @@ func (a AstParser) Expr(expr parsetree.Expr) (e ast.Expr) {
 		return a.FuncCallExpr(expr)
 	case parsetree.FuncDef:
 		return a.FuncDef(expr)
+	case parsetree.Instantiation:
+		name := a.Ident(expr.Name)
+		return ast.Instantiation{
+			Name:     name,
+			TypeArgs: a.TypeVars(&expr.TypeVars),
+			Tokens: ast.Tokens{
+				FirstToken: name.FirstToken,
+				LastToken:  &expr.TypeVars.Rbracket,
+			},
+		}
+	case parsetree.IsExpr:
+		left := a.Expr(expr.Left)
+		ty := a.Type(expr.Type)
+		return ast.IsExpr{
+			Left: left,
+			Type: ty,
+			Tokens: ast.Tokens{
+				FirstToken: left.FirstTok(),
+				LastToken:  ty.LastToken,
+			},
+		}
 	default:
 		fmt.Printf("ast unknown expr %T\n", expr)
 	}
@@ -186,6 +346,9 @@ func (a AstParser) StructLiteralField(field parsetree.StructLiteralField) (slf a
 }
 
 func (a AstParser) Type(type_ parsetree.Type) (t ast.Type) {
+	if type_.Func != nil {
+		return a.FuncType(*type_.Func)
+	}
 	typename := a.Ident(type_.TypeName)
 	typevars := a.TypeVars(type_.TypeVars)
 	firsttoken := type_.TypeName.Name
@@ -205,6 +368,33 @@ func (a AstParser) Type(type_ parsetree.Type) (t ast.Type) {
 	}
 }
 
+// FuncType turns `func(A, B) R` into the type `func[A, B, R]`, with a `nil` return type if there is none.
+func (a AstParser) FuncType(funcType parsetree.FuncType) (t ast.Type) {
+	firsttoken := funcType.FuncKw
+	vars := []ast.Type{}
+	for _, pair := range funcType.Params {
+		vars = append(vars, a.Type(pair.First))
+	}
+	var ret ast.Type
+	if funcType.Return != nil {
+		ret = a.Type(*funcType.Return)
+	} else {
+		// there is no `nil` token to point at, so the return type is placed at the `)`
+		rparen := funcType.Rparen
+		tokens := ast.Tokens{FirstToken: &rparen, LastToken: &rparen}
+		ret = ast.Type{Name: ast.Ident{Name: "nil", Tokens: tokens}, Tokens: tokens}
+	}
+	lasttoken := *ret.LastToken
+	return ast.Type{
+		Name: ast.Ident{Name: "func", Tokens: ast.Tokens{FirstToken: &firsttoken, LastToken: &firsttoken}},
+		Vars: append(vars, ret),
+		Tokens: ast.Tokens{
+			FirstToken: &firsttoken,
+			LastToken:  &lasttoken,
+		},
+	}
+}
+
 func (a AstParser) TypeVars(typeVars *parsetree.TypeVars) (tv []ast.Type) {
 	if typeVars == nil {
 		return
@@ -246,19 +436,16 @@ func (a AstParser) StructField(field parsetree.StructField) (f ast.StructField)
 		f.Names = append(f.Names, a.Ident(name.First))
 	}
 	f.Type = a.Type(field.Type)
-	f.FirstToken = f.Names[0].FirstToken
+	f.FirstToken = f.Type.FirstToken
+	if len(f.Names) > 0 {
+		f.FirstToken = f.Names[0].FirstToken
+	}
 	f.LastToken = f.Type.LastToken
 	return f
 }
 
 func (a AstParser) FieldAccess(expr parsetree.FieldAccess) (fa ast.FieldAccess) {
-	var lv ast.Lvalue
-	switch l := expr.Lvalue.(type) {
-	case parsetree.Ident:
-		lv = a.Ident(l)
-	case parsetree.FieldAccess:
-		lv = a.FieldAccess(l)
-	}
+	lv := a.Lvalue(expr.Lvalue)
 	f := a.Ident(expr.Field)
 	return ast.FieldAccess{
 		Lvalue: lv,
@@ -318,8 +505,9 @@ func (a AstParser) FuncCallExpr(expr parsetree.FuncCallExpr) ast.Expr {
 		lastTok = args[len(args)-1].LastTok()
 	}
 	return ast.FuncCallExpr{
-		Name: name,
-		Args: args,
+		Name:     name,
+		TypeArgs: a.TypeVars(expr.TypeVars),
+		Args:     args,
 		Tokens: ast.Tokens{
 			FirstToken: name.FirstTok(),
 			LastToken:  lastTok,
@@ -350,12 +538,71 @@ func (a AstParser) FuncDef(expr parsetree.FuncDef) ast.Expr {
 	}
 
 	return ast.FuncDef{
+		TypeParams: a.TypeVars(expr.TypeVars),
 		Args:       args,
 		ReturnType: returnType,
 		Body:       body,
+		Broken:     expr.Broken,
 		Tokens: ast.Tokens{
 			FirstToken: &expr.FuncKw,
 			LastToken:  &expr.Rbrace,
 		},
 	}
 }
+
+func (a AstParser) Index(expr parsetree.Index) ast.Index {
+	lv := a.Lvalue(expr.Lvalue)
+	index := a.Expr(expr.Index)
+	rbracket := expr.Rbracket
+	return ast.Index{
+		Lvalue: lv,
+		Index:  index,
+		Tokens: ast.Tokens{
+			FirstToken: lv.FirstTok(),
+			LastToken:  &rbracket,
+		},
+	}
+}
+
+func (a AstParser) ListLiteral(expr parsetree.ListLiteral) ast.ListLiteral {
+	typeName := a.Type(expr.TypeName)
+	elems := []ast.Expr{}
+	for _, elem := range expr.Elems {
+		elems = append(elems, a.Expr(elem.First))
+	}
+	rbrace := expr.Rbrace
+	return ast.ListLiteral{
+		TypeName: typeName,
+		Elems:    elems,
+		Tokens: ast.Tokens{
+			FirstToken: typeName.FirstToken,
+			LastToken:  &rbrace,
+		},
+	}
+}
+
+func (a AstParser) MapLiteral(expr parsetree.MapLiteral) ast.MapLiteral {
+	typeName := a.Type(expr.TypeName)
+	entries := []ast.MapEntry{}
+	for _, pair := range expr.Entries {
+		key := a.Expr(pair.First.Key)
+		value := a.Expr(pair.First.Value)
+		entries = append(entries, ast.MapEntry{
+			Key:   key,
+			Value: value,
+			Tokens: ast.Tokens{
+				FirstToken: key.FirstTok(),
+				LastToken:  value.LastTok(),
+			},
+		})
+	}
+	rbrace := expr.Rbrace
+	return ast.MapLiteral{
+		TypeName: typeName,
+		Entries:  entries,
+		Tokens: ast.Tokens{
+			FirstToken: typeName.FirstToken,
+			LastToken:  &rbrace,
+		},
+	}
+}
@@ -36,7 +36,7 @@ type PrefixOperator struct {
 }
 
 func (pop PrefixOperator) Parse(parser *ParseTreeParser, op token.Token) (parsetree.Expr, error) {
-	poperr := fmt.Errorf("in prefix operator `%s`", op.String())
+	poperr := fmt.Errorf("in prefix operator `%s`", op.Lexeme())
 	right, err := parser.Expr(pop.prec)
 	if err != nil {
 		return right, errors.Join(poperr, err)
@@ -50,6 +50,7 @@ func (pop PrefixOperator) Precedence() precedence.Precedence {
 type GroupingParselet struct{}
 
 func (gp GroupingParselet) Parse(parser *ParseTreeParser, lparen token.Token) (parsetree.Expr, error) {
+	defer parser.setNoStructLiteral(parser.setNoStructLiteral(false))
 	expr, err := parser.Expr(precedence.BOTTOM)
 	if err != nil {
 		return expr, err
@@ -67,7 +68,7 @@ type BinaryOperator struct {
 }
 
 func (bop BinaryOperator) Parse(parser *ParseTreeParser, left parsetree.Expr, op token.Token) (parsetree.Expr, error) {
-	boperr := fmt.Errorf("in infix operator `%s`", op.String())
+	boperr := fmt.Errorf("in infix operator `%s`", op.Lexeme())
 	prec := bop.prec
 	if bop.isRight {
 		prec -= 1
@@ -86,7 +87,12 @@ func (bop BinaryOperator) Precedence() precedence.Precedence {
 type CallParselet struct{}
 
 func (cp CallParselet) Parse(parser *ParseTreeParser, expr parsetree.Expr, lparen token.Token) (parsetree.Expr, error) {
+	defer parser.setNoStructLiteral(parser.setNoStructLiteral(false))
 	args := parsetree.SeparatedList[parsetree.Expr, token.Token]{}
+	var typeVars *parsetree.TypeVars
+	if inst, isInstantiation := expr.(parsetree.Instantiation); isInstantiation {
+		expr, typeVars = inst.Name, &inst.TypeVars
+	}
 	funcName, isLvalue := expr.(parsetree.Lvalue)
 	if !isLvalue {
 		return expr, errors.New("expected lvalue for function call")
@@ -122,7 +128,7 @@ func (cp CallParselet) Parse(parser *ParseTreeParser, expr parsetree.Expr, lpare
 	if err != nil {
 		return funcName, err
 	}
-	return parsetree.FuncCallExpr{Name: funcName, Lparen: lparen, Args: args, Rparen: *rparen}, nil
+	return parsetree.FuncCallExpr{Name: funcName, TypeVars: typeVars, Lparen: lparen, Args: args, Rparen: *rparen}, nil
 }
 func (cp CallParselet) Precedence() precedence.Precedence { return precedence.CALL }
 
@@ -130,7 +136,12 @@ type FuncDefParselet struct{}
 
 func (fdp FuncDefParselet) Parse(parser *ParseTreeParser, op token.Token) (parsetree.Expr, error) {
 	fderr := errors.New("in funcdef")
+	defer parser.setNoStructLiteral(parser.setNoStructLiteral(false))
 	funcKw := op
+	typeVars, err := parser.TypeVars()
+	if err != nil {
+		return nil, errors.Join(fderr, errors.New("expected typevars"), err)
+	}
 	lparen, err := parser.expectGet(token.LPAREN)
 	if err != nil {
 		return nil, errors.Join(fderr, err)
@@ -169,7 +180,7 @@ func (fdp FuncDefParselet) Parse(parser *ParseTreeParser, op token.Token) (parse
 		return nil, errors.Join(fderr, err)
 	}
 	var returnType *parsetree.Type = nil
-	if hasReturnType, err := parser.nextTokenIsAny(token.IDENT, token.FUNC); err != nil {
+	if hasReturnType, err := parser.nextTokenIsAny(token.IDENT, token.NIL, token.FUNC); err != nil {
 		return nil, errors.Join(fderr, err)
 	} else if hasReturnType {
 		rt, err := parser.Type()
@@ -182,18 +193,12 @@ func (fdp FuncDefParselet) Parse(parser *ParseTreeParser, op token.Token) (parse
 	if err != nil {
 		return nil, errors.Join(fderr, err)
 	}
-	body := []parsetree.Stmt{}
-	for {
-		if finishFuncBody, err := parser.nextTokenIs(token.RBRACE); err != nil {
-			return nil, errors.Join(fderr, err)
-		} else if finishFuncBody {
-			break
-		}
-		stmt, err := parser.Stmt()
-		if err != nil {
-			return nil, errors.Join(fderr, err)
-		}
-		body = append(body, stmt)
+	skipped := parser.skipped
+	body, err := parser.Stmts()
+	if !parser.hasMoreTokens() && !parser.closedAtEnd {
+		parser.closeAtEnd(fderr)
+	} else if err != nil {
+		return nil, errors.Join(fderr, err)
 	}
 	rbrace, err := parser.expectGet(token.RBRACE)
 	if err != nil {
@@ -201,6 +206,7 @@ func (fdp FuncDefParselet) Parse(parser *ParseTreeParser, op token.Token) (parse
 	}
 	return parsetree.FuncDef{
 		FuncKw:     funcKw,
+		TypeVars:   typeVars,
 		Lparen:     *lparen,
 		Args:       args,
 		Rparen:     *rparen,
@@ -208,5 +214,17 @@ func (fdp FuncDefParselet) Parse(parser *ParseTreeParser, op token.Token) (parse
 		Lbrace:     *lbrace,
 		Body:       body,
 		Rbrace:     *rbrace,
+		Broken:     parser.skipped > skipped,
 	}, err
 }
+
+type IsParselet struct{}
+
+func (ip IsParselet) Parse(parser *ParseTreeParser, left parsetree.Expr, isKw token.Token) (parsetree.Expr, error) {
+	ty, err := parser.Type()
+	if err != nil {
+		return nil, errors.Join(errors.New("in is expr"), err)
+	}
+	return parsetree.IsExpr{Left: left, IsKw: isKw, Type: ty}, nil
+}
+func (ip IsParselet) Precedence() precedence.Precedence { return precedence.COMPARISON }
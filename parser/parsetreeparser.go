@@ -2,19 +2,26 @@ package parser
 
 import (
 	"errors"
-	"fmt"
 
+	"github.com/bigyihsuan/structlang/diag"
 	"github.com/bigyihsuan/structlang/token"
 	"github.com/bigyihsuan/structlang/trees/parsetree"
 	"github.com/bigyihsuan/structlang/trees/precedence"
 	"github.com/bigyihsuan/structlang/util"
 )
 
+// ErrOutOfTokens is returned when the input ends in the middle of a statement.
+var ErrOutOfTokens = errors.New("out of tokens")
+
 type ParseTreeParser struct {
-	tokens    []token.Token
-	idx       int
-	prefixOps map[token.TokenType]PrefixParselet
-	infixOps  map[token.TokenType]InfixParselet
+	tokens          []token.Token
+	idx             int
+	prefixOps       map[token.TokenType]PrefixParselet
+	infixOps        map[token.TokenType]InfixParselet
+	noStructLiteral bool  // set while parsing conditions, where `ident {` starts a block
+	errs            error // syntax errors in statements that were skipped
+	skipped         int   // how many statements were skipped
+	closedAtEnd     bool  // a function body was closed at the end of the tokens, and so are the expressions and statements around it
 }
 
 func NewParser(tokens []token.Token) ParseTreeParser {
@@ -28,6 +35,7 @@ func NewParser(tokens []token.Token) ParseTreeParser {
 	infixOps = infixLeft(infixOps, token.MINUS, precedence.SUM)
 	infixOps = infixLeft(infixOps, token.STAR, precedence.PRODUCT)
 	infixOps = infixLeft(infixOps, token.SLASH, precedence.PRODUCT)
+	infixOps = infixLeft(infixOps, token.PERCENT, precedence.PRODUCT)
 	infixOps = infixLeft(infixOps, token.GT, precedence.COMPARISON)
 	infixOps = infixLeft(infixOps, token.GTEQ, precedence.COMPARISON)
 	infixOps = infixLeft(infixOps, token.LT, precedence.COMPARISON)
@@ -44,6 +52,7 @@ func NewParser(tokens []token.Token) ParseTreeParser {
 	registerPrefix(prefixOps, token.LPAREN, GroupingParselet{})
 	registerInfix(infixOps, token.LPAREN, CallParselet{})
 	registerPrefix(prefixOps, token.FUNC, FuncDefParselet{})
+	registerInfix(infixOps, token.IS, IsParselet{})
 
 	return ParseTreeParser{
 		tokens:    tokens,
@@ -73,6 +82,9 @@ func registerInfix(prefixOps map[token.TokenType]InfixParselet, tt token.TokenTy
 }
 
 func (p ParseTreeParser) Precedence() (precedence.Precedence, error) {
+	if !p.hasMoreTokens() && p.closedAtEnd {
+		return precedence.BOTTOM, nil
+	}
 	tok, err := p.peekNextToken()
 	if err != nil {
 		return 0, err
@@ -85,12 +97,21 @@ func (p ParseTreeParser) Precedence() (precedence.Precedence, error) {
 	}
 }
 
+// lastSpan is the span of the last token, where running out of tokens is reported.
+func (p ParseTreeParser) lastSpan() diag.Span {
+	if len(p.tokens) == 0 {
+		return diag.Span{}
+	}
+	last := &p.tokens[len(p.tokens)-1]
+	return diag.SpanOf(last, last)
+}
+
 func (p ParseTreeParser) hasMoreTokens() bool {
 	return p.idx < len(p.tokens)
 }
 func (p *ParseTreeParser) getNextToken() (tok *token.Token, err error) {
 	if !p.hasMoreTokens() {
-		return tok, errors.New("out of tokens")
+		return tok, ErrOutOfTokens
 	}
 	tok = &p.tokens[p.idx]
 	p.idx++
@@ -98,7 +119,7 @@ func (p *ParseTreeParser) getNextToken() (tok *token.Token, err error) {
 }
 func (p ParseTreeParser) peekNextToken() (tok *token.Token, err error) {
 	if !p.hasMoreTokens() {
-		return tok, errors.New("out of tokens")
+		return tok, ErrOutOfTokens
 	}
 	tok = &p.tokens[p.idx]
 	return tok, nil
@@ -107,13 +128,24 @@ func (p *ParseTreeParser) putBackToken() {
 	p.idx--
 }
 
+// setNoStructLiteral sets whether `ident {` is kept from being parsed as a struct literal,
+// and returns the previous setting so that it can be restored.
+func (p *ParseTreeParser) setNoStructLiteral(noStructLiteral bool) bool {
+	prev := p.noStructLiteral
+	p.noStructLiteral = noStructLiteral
+	return prev
+}
+
 func (p *ParseTreeParser) expectGet(tt token.TokenType) (*token.Token, error) {
+	if !p.hasMoreTokens() && p.closedAtEnd && isCloser(tt) {
+		return &p.tokens[len(p.tokens)-1], nil
+	}
 	tok, err := p.getNextToken()
 	if err != nil {
 		return tok, err
 	}
 	if tok.Type() != tt {
-		return tok, fmt.Errorf("expected token `%s`, got `%s` at `%v`", tt, tok.Type(), tok.Position())
+		return tok, diag.At(diag.SpanOf(tok, tok), "expected token `%s`, got `%s`", tt, tok.Type())
 	}
 	return tok, nil
 }
@@ -127,10 +159,13 @@ func (p *ParseTreeParser) expectGetAny(tts ...token.TokenType) (*token.Token, er
 			return tok, nil
 		}
 	}
-	return tok, fmt.Errorf("expected any token %s, got `%s` at `%v`", tts, tok.Type(), tok.Position())
+	return tok, diag.At(diag.SpanOf(tok, tok), "expected any token %s, got `%s`", tts, tok.Type())
 }
 
 func (p ParseTreeParser) nextTokenIs(tt token.TokenType) (bool, error) {
+	if !p.hasMoreTokens() && p.closedAtEnd {
+		return isCloser(tt), nil
+	}
 	next, err := p.peekNextToken()
 	if err != nil {
 		return false, err
@@ -138,6 +173,14 @@ func (p ParseTreeParser) nextTokenIs(tt token.TokenType) (bool, error) {
 	return next.Type() == tt, nil
 }
 func (p ParseTreeParser) nextTokenIsAny(tts ...token.TokenType) (bool, error) {
+	if !p.hasMoreTokens() && p.closedAtEnd {
+		for _, tt := range tts {
+			if isCloser(tt) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
 	next, err := p.peekNextToken()
 	if err != nil {
 		return false, err
@@ -150,21 +193,121 @@ func (p ParseTreeParser) nextTokenIsAny(tts ...token.TokenType) (bool, error) {
 	return false, nil
 }
 
+// Parse returns the statements in the tokens.
+// Syntax errors are returned as diag.Diagnostics, with the parser's context as their notes.
+// Statements with errors are left out, but every other statement is still returned.
+// A function body that the tokens end in is closed there, and kept with the statements around it.
 func (p *ParseTreeParser) Parse() (stmts []parsetree.Stmt, errs error) {
 	for p.hasMoreTokens() {
-		if hasRbrace, err := p.nextTokenIs(token.RBRACE); err != nil {
+		s, err := p.Stmts()
+		stmts = append(stmts, s...)
+		if err != nil {
+			return stmts, errors.Join(p.errs, diag.FromChain(err, p.lastSpan()))
+		}
+		if rbrace, err := p.getNextToken(); err == nil {
+			p.errs = errors.Join(p.errs, diag.At(diag.SpanOf(rbrace, rbrace), "unexpected `}`"))
+		}
+	}
+	return stmts, p.errs
+}
+
+// Stmts parses statements up to the `}` closing the enclosing block, or to the end of the tokens.
+// A statement with a syntax error is recorded and skipped, so the statements after it are still parsed.
+func (p *ParseTreeParser) Stmts() (stmts []parsetree.Stmt, err error) {
+	for p.hasMoreTokens() {
+		if finished, _ := p.nextTokenIs(token.RBRACE); finished {
+			break
+		}
+		start := p.idx
+		stmt, err := p.Stmt()
+		if errors.Is(err, ErrOutOfTokens) {
 			return stmts, err
-		} else if hasRbrace {
-			return stmts, nil
+		} else if err != nil {
+			p.recover(start, err)
+			continue
 		}
-		s, e := p.Stmt()
-		if e != nil {
-			return stmts, errors.Join(errors.New("in parse tree parser"), e)
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// recover records err from the statement starting at start, and skips to where the next statement should begin:
+// after a `;` or a closed block, before a statement keyword, or before the `}` closing the enclosing block.
+func (p *ParseTreeParser) recover(start int, err error) {
+	p.errs = errors.Join(p.errs, diag.FromChain(err, p.lastSpan()))
+	p.skipped++
+
+	// count the blocks the statement opened before failing
+	depth := 0
+	for i := start; i < p.idx; i++ {
+		switch p.tokens[i].Type() {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth < 0 {
+				// that `}` closes the enclosing block
+				p.idx = i
+				return
+			}
 		}
-		stmts = append(stmts, s)
 	}
-	return stmts, errs
+	if p.idx == start {
+		p.idx++
+	} else if depth == 0 && p.tokens[p.idx-1].Type() == token.SEMICOLON {
+		return
+	} else if p.idx-1 > start && isStmtKeyword(p.tokens[p.idx-1].Type()) {
+		// the statement is missing its end, and the next one was read by mistake
+		p.idx--
+	}
+
+	for p.hasMoreTokens() {
+		switch p.tokens[p.idx].Type() {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.idx++
+				return
+			}
+		default:
+			if depth == 0 && isStmtKeyword(p.tokens[p.idx].Type()) {
+				return
+			}
+		}
+		p.idx++
+	}
+}
+
+// closeAtEnd records that the tokens end in a function body, usually because it is still being written.
+// The body is closed there, and so is everything around it, so that what is defined in them is still checked.
+func (p *ParseTreeParser) closeAtEnd(context error) {
+	p.errs = errors.Join(p.errs, diag.FromChain(errors.Join(context, ErrOutOfTokens), p.lastSpan()))
+	p.skipped++
+	p.closedAtEnd = true
+}
+
+func isCloser(tt token.TokenType) bool {
+	switch tt {
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.SEMICOLON:
+		return true
+	}
+	return false
 }
+
+func isStmtKeyword(tt token.TokenType) bool {
+	switch tt {
+	case token.TYPE, token.LET, token.SET, token.RETURN, token.IF, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.MATCH:
+		return true
+	}
+	return false
+}
+
 func (p *ParseTreeParser) Stmt() (stmt parsetree.Stmt, errs error) {
 	stmterr := errors.New("in stmt")
 	kw, err := p.peekNextToken()
@@ -196,6 +339,55 @@ func (p *ParseTreeParser) Stmt() (stmt parsetree.Stmt, errs error) {
 			return rs, errors.Join(stmterr, errors.New("expected return with kw `return`"), err)
 		}
 		return rs, nil
+	case token.IF:
+		is, err := p.IfStmt()
+		if err != nil {
+			return is, errors.Join(stmterr, errors.New("expected if with kw `if`"), err)
+		}
+		return is, nil
+	case token.WHILE:
+		ws, err := p.WhileStmt()
+		if err != nil {
+			return ws, errors.Join(stmterr, errors.New("expected while with kw `while`"), err)
+		}
+		return ws, nil
+	case token.FOR:
+		fs, err := p.ForStmt()
+		if err != nil {
+			return fs, errors.Join(stmterr, errors.New("expected for with kw `for`"), err)
+		}
+		return fs, nil
+	case token.BREAK:
+		bs, err := p.BreakStmt()
+		if err != nil {
+			return bs, errors.Join(stmterr, errors.New("expected break with kw `break`"), err)
+		}
+		return bs, nil
+	case token.CONTINUE:
+		cs, err := p.ContinueStmt()
+		if err != nil {
+			return cs, errors.Join(stmterr, errors.New("expected continue with kw `continue`"), err)
+		}
+		return cs, nil
+	case token.MATCH:
+		ms, err := p.MatchStmt()
+		if err != nil {
+			return ms, errors.Join(stmterr, errors.New("expected match with kw `match`"), err)
+		}
+		return ms, nil
+	case token.FUNC:
+		if !p.isMethodDef() {
+			expr, err := p.ExprStmt()
+			if err != nil {
+				return expr, errors.Join(stmterr, err)
+			}
+			return expr, nil
+		}
+		md, err := p.MethodDef()
+		if err != nil {
+			return md, errors.Join(stmterr, errors.New("expected method with kw `func`"), err)
+		}
+		return md, nil
 	default:
 		expr, err := p.ExprStmt()
 		if err != nil {
@@ -206,6 +398,68 @@ func (p *ParseTreeParser) Stmt() (stmt parsetree.Stmt, errs error) {
 	}
 }
 
+// isMethodDef reports whether the `func` coming up starts a method, which has a name after its receiver,
+// instead of a func literal.
+func (p ParseTreeParser) isMethodDef() bool {
+	i := p.idx + 1
+	if i >= len(p.tokens) || p.tokens[i].Type() != token.LPAREN {
+		return false
+	}
+	for depth := 0; i < len(p.tokens); i++ {
+		switch p.tokens[i].Type() {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return i+2 < len(p.tokens) && p.tokens[i+1].Type() == token.IDENT &&
+		(p.tokens[i+2].Type() == token.LPAREN || p.tokens[i+2].Type() == token.LBRACKET)
+}
+
+func (p *ParseTreeParser) MethodDef() (md parsetree.MethodDef, errs error) {
+	mderr := errors.New("in methoddef")
+	funcKw, err := p.expectGet(token.FUNC)
+	if err != nil {
+		return md, errors.Join(mderr, err)
+	}
+	lparen, err := p.expectGet(token.LPAREN)
+	if err != nil {
+		return md, errors.Join(mderr, err)
+	}
+	recvName, err := p.Ident()
+	if err != nil {
+		return md, errors.Join(mderr, errors.New("expected receiver"), err)
+	}
+	recvType, err := p.Type()
+	if err != nil {
+		return md, errors.Join(mderr, errors.New("expected receiver type"), err)
+	}
+	rparen, err := p.expectGet(token.RPAREN)
+	if err != nil {
+		return md, errors.Join(mderr, err)
+	}
+	name, err := p.Ident()
+	if err != nil {
+		return md, errors.Join(mderr, errors.New("expected method name"), err)
+	}
+	fd, err := FuncDefParselet{}.Parse(p, *funcKw)
+	if err != nil {
+		return md, errors.Join(mderr, err)
+	}
+	return parsetree.MethodDef{
+		FuncKw:   *funcKw,
+		Lparen:   *lparen,
+		Receiver: parsetree.FuncArg{Name: recvName, Type: recvType},
+		Rparen:   *rparen,
+		Name:     name,
+		Func:     fd.(parsetree.FuncDef),
+	}, nil
+}
+
 func (p *ParseTreeParser) VarDef() (vd parsetree.VarDef, errs error) {
 	vderr := errors.New("in vardef")
 	letkw, err := p.expectGet(token.LET)
@@ -288,20 +542,40 @@ func (p *ParseTreeParser) TypeDef() (td parsetree.TypeDef, errs error) {
 	if err != nil {
 		return td, errors.Join(tderr, err)
 	}
-	structDef, err := p.StructDef()
-	if err != nil {
-		return td, errors.Join(tderr, errors.New("expected structdef"), err)
+	td = parsetree.TypeDef{TypeKw: *type_, TypeName: typename, Eq: *eq}
+	if isStruct, err := p.nextTokenIs(token.STRUCT); err != nil {
+		return td, errors.Join(tderr, err)
+	} else if isStruct {
+		td.StructDef, err = p.StructDef()
+		if err != nil {
+			return td, errors.Join(tderr, errors.New("expected structdef"), err)
+		}
+	} else {
+		alias, err := p.Type()
+		if err != nil {
+			return td, errors.Join(tderr, errors.New("expected structdef or aliased type"), err)
+		}
+		td.Alias = &alias
 	}
 	sc, err := p.expectGet(token.SEMICOLON)
 	if err != nil {
 		return td, errors.Join(tderr, err)
 	}
-
-	return parsetree.TypeDef{TypeKw: *type_, TypeName: typename, Eq: *eq, StructDef: structDef, Sc: *sc}, nil
+	td.Sc = *sc
+	return td, nil
 }
 
 func (p *ParseTreeParser) Type() (ty parsetree.Type, errs error) {
 	tyerr := errors.New("in type")
+	if isFunc, err := p.nextTokenIsAny(token.FUNC); err != nil {
+		return ty, errors.Join(tyerr, err)
+	} else if isFunc {
+		funcType, err := p.FuncType()
+		if err != nil {
+			return ty, errors.Join(tyerr, err)
+		}
+		return parsetree.Type{TypeName: parsetree.Ident{Name: funcType.FuncKw}, Func: &funcType}, nil
+	}
 	typename, err := p.Ident()
 	if err != nil {
 		return ty, errors.Join(tyerr, err)
@@ -313,6 +587,37 @@ func (p *ParseTreeParser) Type() (ty parsetree.Type, errs error) {
 	return parsetree.Type{TypeName: typename, TypeVars: typevars}, nil
 }
 
+func (p *ParseTreeParser) FuncType() (ft parsetree.FuncType, errs error) {
+	fterr := errors.New("in func type")
+	funcKw, err := p.expectGet(token.FUNC)
+	if err != nil {
+		return ft, errors.Join(fterr, err)
+	}
+	lparen, err := p.expectGet(token.LPAREN)
+	if err != nil {
+		return ft, errors.Join(fterr, err)
+	}
+	params, err := p.TypeVarParams()
+	if err != nil {
+		return ft, errors.Join(fterr, errors.New("expected param types"), err)
+	}
+	rparen, err := p.expectGet(token.RPAREN)
+	if err != nil {
+		return ft, errors.Join(fterr, err)
+	}
+	ft = parsetree.FuncType{FuncKw: *funcKw, Lparen: *lparen, Params: params, Rparen: *rparen}
+	if hasReturnType, err := p.nextTokenIsAny(token.IDENT, token.NIL, token.FUNC); err != nil {
+		return ft, errors.Join(fterr, err)
+	} else if hasReturnType {
+		rt, err := p.Type()
+		if err != nil {
+			return ft, errors.Join(fterr, errors.New("expected return type"), err)
+		}
+		ft.Return = &rt
+	}
+	return ft, nil
+}
+
 func (p *ParseTreeParser) TypeVars() (tvs *parsetree.TypeVars, errs error) {
 	tvserr := errors.New("in typevars")
 	if peeked, err := p.peekNextToken(); err != nil {
@@ -340,7 +645,7 @@ func (p *ParseTreeParser) TypeVarParams() (tv parsetree.SeparatedList[parsetree.
 	for {
 		if peeked, err := p.peekNextToken(); err != nil {
 			return tv, errors.Join(tvperr, err)
-		} else if peeked.Type() != token.IDENT && peeked.Type() != token.NIL {
+		} else if tt := peeked.Type(); tt != token.IDENT && tt != token.NIL && tt != token.FUNC {
 			// 0 eles, or with trailing sep
 			return tv, nil
 		}
@@ -403,9 +708,22 @@ func (p *ParseTreeParser) StructFields() (f []parsetree.StructField, errs error)
 		} else if len(names) < 1 {
 			return f, errors.Join(sferr, errors.New("name list must be len > 0"))
 		}
-		typename, err := p.Type()
-		if err != nil {
-			return f, errors.Join(sferr, errors.New("expected typename"), err)
+		var typename parsetree.Type
+		if peeked, err := p.peekNextToken(); err != nil {
+			return f, errors.Join(sferr, err)
+		} else if tt := peeked.Type(); len(names) == 1 && names[0].Last == nil && (tt == token.SEMICOLON || tt == token.RBRACE || tt == token.LBRACKET) {
+			// an embedded field is only a type
+			typevars, err := p.TypeVars()
+			if err != nil {
+				return f, errors.Join(sferr, errors.New("expected embedded type"), err)
+			}
+			typename = parsetree.Type{TypeName: names[0].First, TypeVars: typevars}
+			names = nil
+		} else {
+			typename, err = p.Type()
+			if err != nil {
+				return f, errors.Join(sferr, errors.New("expected typename"), err)
+			}
 		}
 		if peeked, err := p.peekNextToken(); err != nil {
 			return f, errors.Join(sferr, err)
@@ -478,6 +796,229 @@ func (p *ParseTreeParser) ReturnStmt() (stmt parsetree.ReturnStmt, err error) {
 	}, nil
 }
 
+func (p *ParseTreeParser) IfStmt() (stmt parsetree.IfStmt, err error) {
+	iserr := errors.New("in ifstmt")
+	ifKw, err := p.expectGet(token.IF)
+	if err != nil {
+		return stmt, errors.Join(iserr, err)
+	}
+	cond, err := p.Cond()
+	if err != nil {
+		return stmt, errors.Join(iserr, errors.New("expected condition"), err)
+	}
+	then, err := p.Block()
+	if err != nil {
+		return stmt, errors.Join(iserr, err)
+	}
+	stmt = parsetree.IfStmt{IfKw: *ifKw, Cond: cond, Then: then}
+	if hasElse, err := p.nextTokenIs(token.ELSE); err != nil {
+		// an `if` can be the last statement of the program
+		return stmt, nil
+	} else if !hasElse {
+		return stmt, nil
+	}
+	elseKw, err := p.expectGet(token.ELSE)
+	if err != nil {
+		return stmt, errors.Join(iserr, err)
+	}
+	if hasElseIf, err := p.nextTokenIs(token.IF); err != nil {
+		return stmt, errors.Join(iserr, err)
+	} else if hasElseIf {
+		elseIf, err := p.IfStmt()
+		if err != nil {
+			return stmt, errors.Join(iserr, errors.New("expected `else if`"), err)
+		}
+		stmt.Else = &parsetree.ElseClause{ElseKw: *elseKw, If: &elseIf}
+		return stmt, nil
+	}
+	block, err := p.Block()
+	if err != nil {
+		return stmt, errors.Join(iserr, err)
+	}
+	stmt.Else = &parsetree.ElseClause{ElseKw: *elseKw, Block: &block}
+	return stmt, nil
+}
+
+func (p *ParseTreeParser) WhileStmt() (stmt parsetree.WhileStmt, err error) {
+	wserr := errors.New("in whilestmt")
+	whileKw, err := p.expectGet(token.WHILE)
+	if err != nil {
+		return stmt, errors.Join(wserr, err)
+	}
+	cond, err := p.Cond()
+	if err != nil {
+		return stmt, errors.Join(wserr, errors.New("expected condition"), err)
+	}
+	body, err := p.Block()
+	if err != nil {
+		return stmt, errors.Join(wserr, err)
+	}
+	return parsetree.WhileStmt{WhileKw: *whileKw, Cond: cond, Body: body}, nil
+}
+
+func (p *ParseTreeParser) ForStmt() (stmt parsetree.ForStmt, err error) {
+	fserr := errors.New("in forstmt")
+	forKw, err := p.expectGet(token.FOR)
+	if err != nil {
+		return stmt, errors.Join(fserr, err)
+	}
+	stmt.ForKw = *forKw
+	elem, err := p.expectGet(token.IDENT)
+	if err != nil {
+		return stmt, errors.Join(fserr, errors.New("expected loop variable"), err)
+	}
+	stmt.Elem = parsetree.Ident{Name: *elem}
+	if hasIndex, err := p.nextTokenIs(token.COMMA); err != nil {
+		return stmt, errors.Join(fserr, err)
+	} else if hasIndex {
+		comma, _ := p.getNextToken()
+		elem, err := p.expectGet(token.IDENT)
+		if err != nil {
+			return stmt, errors.Join(fserr, errors.New("expected loop variable"), err)
+		}
+		stmt.Index, stmt.Comma = &parsetree.Ident{Name: stmt.Elem.Name}, comma
+		stmt.Elem = parsetree.Ident{Name: *elem}
+	}
+	inKw, err := p.expectGet(token.IN)
+	if err != nil {
+		return stmt, errors.Join(fserr, err)
+	}
+	stmt.InKw = *inKw
+	stmt.Iterable, err = p.Cond()
+	if err != nil {
+		return stmt, errors.Join(fserr, errors.New("expected iterable"), err)
+	}
+	if isRange, err := p.nextTokenIs(token.DOTDOT); err != nil {
+		return stmt, errors.Join(fserr, err)
+	} else if isRange {
+		stmt.DotDot, _ = p.getNextToken()
+		stmt.End, err = p.Cond()
+		if err != nil {
+			return stmt, errors.Join(fserr, errors.New("expected end of range"), err)
+		}
+	}
+	stmt.Body, err = p.Block()
+	if err != nil {
+		return stmt, errors.Join(fserr, err)
+	}
+	return stmt, nil
+}
+
+func (p *ParseTreeParser) BreakStmt() (stmt parsetree.BreakStmt, err error) {
+	bserr := errors.New("in breakstmt")
+	breakKw, err := p.expectGet(token.BREAK)
+	if err != nil {
+		return stmt, errors.Join(bserr, err)
+	}
+	sc, err := p.expectGet(token.SEMICOLON)
+	if err != nil {
+		return stmt, errors.Join(bserr, err)
+	}
+	return parsetree.BreakStmt{BreakKw: *breakKw, Sc: *sc}, nil
+}
+
+func (p *ParseTreeParser) ContinueStmt() (stmt parsetree.ContinueStmt, err error) {
+	cserr := errors.New("in continuestmt")
+	continueKw, err := p.expectGet(token.CONTINUE)
+	if err != nil {
+		return stmt, errors.Join(cserr, err)
+	}
+	sc, err := p.expectGet(token.SEMICOLON)
+	if err != nil {
+		return stmt, errors.Join(cserr, err)
+	}
+	return parsetree.ContinueStmt{ContinueKw: *continueKw, Sc: *sc}, nil
+}
+
+func (p *ParseTreeParser) MatchStmt() (stmt parsetree.MatchStmt, err error) {
+	mserr := errors.New("in matchstmt")
+	matchKw, err := p.expectGet(token.MATCH)
+	if err != nil {
+		return stmt, errors.Join(mserr, err)
+	}
+	subject, err := p.Cond()
+	if err != nil {
+		return stmt, errors.Join(mserr, errors.New("expected match subject"), err)
+	}
+	lbrace, err := p.expectGet(token.LBRACE)
+	if err != nil {
+		return stmt, errors.Join(mserr, err)
+	}
+	arms := []parsetree.MatchArm{}
+	for {
+		if finishArms, err := p.nextTokenIs(token.RBRACE); err != nil {
+			return stmt, errors.Join(mserr, err)
+		} else if finishArms {
+			break
+		}
+		arm, err := p.MatchArm()
+		if err != nil {
+			return stmt, errors.Join(mserr, err)
+		}
+		arms = append(arms, arm)
+	}
+	rbrace, err := p.expectGet(token.RBRACE)
+	if err != nil {
+		return stmt, errors.Join(mserr, err)
+	}
+	return parsetree.MatchStmt{MatchKw: *matchKw, Subject: subject, Lbrace: *lbrace, Arms: arms, Rbrace: *rbrace}, nil
+}
+
+// MatchArm parses `name Type { ... }` or `Type { ... }`.
+func (p *ParseTreeParser) MatchArm() (arm parsetree.MatchArm, err error) {
+	maerr := errors.New("in match arm")
+	first, err := p.getNextToken()
+	if err != nil {
+		return arm, errors.Join(maerr, err)
+	}
+	hasBinding, err := p.nextTokenIsAny(token.IDENT, token.NIL)
+	if err != nil {
+		return arm, errors.Join(maerr, err)
+	}
+	p.putBackToken()
+	if first.Type() == token.IDENT && hasBinding {
+		binding, err := p.Ident()
+		if err != nil {
+			return arm, errors.Join(maerr, err)
+		}
+		arm.Binding = &binding
+	}
+	arm.Type, err = p.Type()
+	if err != nil {
+		return arm, errors.Join(maerr, errors.New("expected arm type"), err)
+	}
+	arm.Body, err = p.Block()
+	if err != nil {
+		return arm, errors.Join(maerr, err)
+	}
+	return arm, nil
+}
+
+// Cond parses the condition of an `if` or `while`.
+// Struct literals must be parenthesized there, since `{` starts the block.
+func (p *ParseTreeParser) Cond() (expr parsetree.Expr, err error) {
+	defer p.setNoStructLiteral(p.setNoStructLiteral(true))
+	return p.Expr(precedence.BOTTOM)
+}
+
+func (p *ParseTreeParser) Block() (block parsetree.Block, err error) {
+	berr := errors.New("in block")
+	defer p.setNoStructLiteral(p.setNoStructLiteral(false))
+	lbrace, err := p.expectGet(token.LBRACE)
+	if err != nil {
+		return block, errors.Join(berr, err)
+	}
+	stmts, err := p.Stmts()
+	if err != nil {
+		return block, errors.Join(berr, err)
+	}
+	rbrace, err := p.expectGet(token.RBRACE)
+	if err != nil {
+		return block, errors.Join(berr, err)
+	}
+	return parsetree.Block{Lbrace: *lbrace, Stmts: stmts, Rbrace: *rbrace}, nil
+}
+
 func (p *ParseTreeParser) ExprStmt() (stmt parsetree.ExprStmt, err error) {
 	eserr := errors.New("in exprstmt")
 	e, err := p.Expr(precedence.BOTTOM)
@@ -499,7 +1040,7 @@ func (p *ParseTreeParser) Expr(precedence precedence.Precedence) (expr parsetree
 	}
 	pp, isPrefix := p.prefixOps[tok.Type()]
 	if !isPrefix {
-		return expr, errors.Join(exprerr, fmt.Errorf("could not get prefix parslet for token `%s`", tok))
+		return expr, errors.Join(exprerr, diag.At(diag.SpanOf(tok, tok), "could not get prefix parslet for token `%s`", tok.Type()))
 	}
 	expr, err = pp.Parse(p, *tok)
 	if err != nil {
@@ -517,7 +1058,7 @@ func (p *ParseTreeParser) Expr(precedence precedence.Precedence) (expr parsetree
 		}
 		infix, hasInfix := p.infixOps[op.Type()]
 		if !hasInfix {
-			return expr, errors.Join(exprerr, fmt.Errorf("could not get infix parslet for token `%s`", tok))
+			return expr, errors.Join(exprerr, diag.At(diag.SpanOf(op, op), "could not get infix parslet for token `%s`", op.Type()))
 		}
 		expr, err = infix.Parse(p, expr, *op)
 		if err != nil {
@@ -546,9 +1087,25 @@ func (p *ParseTreeParser) IdentOrStructLiteralOrFieldAccess() (expr parsetree.Ex
 	if err != nil {
 		return expr, errors.Join(islerr, err)
 	}
+	if hasTypeVars, err := p.nextTokenIs(token.LBRACKET); err != nil {
+		return expr, errors.Join(islerr, err)
+	} else if hasTypeVars {
+		// `name[...]` is a struct literal if a `{` follows, and a generic function otherwise
+		start := p.idx
+		typeVars, err := p.TypeVars()
+		if err != nil {
+			return expr, errors.Join(islerr, err)
+		}
+		if isStructLiteral, err := p.nextTokenIs(token.LBRACE); err != nil {
+			return expr, errors.Join(islerr, err)
+		} else if !isStructLiteral || p.noStructLiteral {
+			return parsetree.Instantiation{Name: parsetree.Ident{Name: *ident}, TypeVars: *typeVars}, nil
+		}
+		p.idx = start
+	}
 	if hasStructLiteral, err := p.nextTokenIsAny(token.LBRACE, token.LBRACKET); err != nil {
 		return expr, errors.Join(islerr, err)
-	} else if hasStructLiteral {
+	} else if hasStructLiteral && !p.noStructLiteral {
 		p.putBackToken()
 		sl, err := p.StructLiteral()
 		if err != nil {
@@ -578,7 +1135,8 @@ func (p *ParseTreeParser) Ident() (i parsetree.Ident, err error) {
 	return parsetree.Ident{Name: *name}, nil
 }
 
-func (p *ParseTreeParser) StructLiteral() (sl parsetree.StructLiteral, err error) {
+// StructLiteral parses a struct literal, or a list or map literal if the braces hold elements instead of fields.
+func (p *ParseTreeParser) StructLiteral() (sl parsetree.Expr, err error) {
 	slerr := errors.New("in struct literal")
 	typename, err := p.Type()
 	if err != nil {
@@ -588,6 +1146,13 @@ func (p *ParseTreeParser) StructLiteral() (sl parsetree.StructLiteral, err error
 	if err != nil {
 		return sl, errors.Join(slerr, err)
 	}
+	if p.hasElems(typename) {
+		lm, err := p.ListOrMapLiteral(typename, *lbrace)
+		if err != nil {
+			return sl, errors.Join(slerr, err)
+		}
+		return lm, nil
+	}
 	fields, err := p.StructLiteralFields()
 	if err != nil {
 		return sl, errors.Join(slerr, errors.New("expected struct literal fields"), err)
@@ -599,6 +1164,86 @@ func (p *ParseTreeParser) StructLiteral() (sl parsetree.StructLiteral, err error
 	return parsetree.StructLiteral{TypeName: typename, Lbrace: *lbrace, Fields: fields, Rbrace: *rbrace}, nil
 }
 
+// hasElems reports whether the literal of typename whose `{` was just parsed gives elements or map entries,
+// which is anything but nothing at all or, unless it is a map, a field name followed by `:`.
+func (p ParseTreeParser) hasElems(typename parsetree.Type) bool {
+	if p.idx+1 >= len(p.tokens) {
+		return false
+	}
+	next := p.tokens[p.idx].Type()
+	if next == token.RBRACE {
+		return false
+	}
+	if typename.TypeName.Name.Lexeme() == "map" {
+		// the keys of a map can be variables
+		return true
+	}
+	return !((next == token.IDENT || next == token.NIL) && p.tokens[p.idx+1].Type() == token.COLON)
+}
+
+// ListOrMapLiteral parses the elements of a list literal, or the `key: value` entries of a map literal
+// if the first one has a `:`.
+func (p *ParseTreeParser) ListOrMapLiteral(typename parsetree.Type, lbrace token.Token) (expr parsetree.Expr, err error) {
+	lmerr := errors.New("in list/map literal")
+	ll := parsetree.ListLiteral{TypeName: typename, Lbrace: lbrace}
+	ml := parsetree.MapLiteral{TypeName: typename, Lbrace: lbrace}
+	isMap := false
+	for first := true; ; first = false {
+		if isEnd, err := p.nextTokenIs(token.RBRACE); err != nil {
+			return expr, errors.Join(lmerr, err)
+		} else if isEnd {
+			break
+		}
+		elem, err := p.Expr(precedence.BOTTOM)
+		if err != nil {
+			return expr, errors.Join(lmerr, errors.New("expected expr"), err)
+		}
+		if first {
+			if isMap, err = p.nextTokenIs(token.COLON); err != nil {
+				return expr, errors.Join(lmerr, err)
+			}
+		}
+		var entry parsetree.MapEntry
+		if isMap {
+			colon, err := p.expectGet(token.COLON)
+			if err != nil {
+				return expr, errors.Join(lmerr, err)
+			}
+			value, err := p.Expr(precedence.BOTTOM)
+			if err != nil {
+				return expr, errors.Join(lmerr, errors.New("expected expr"), err)
+			}
+			entry = parsetree.MapEntry{Key: elem, Colon: *colon, Value: value}
+		}
+		var comma *token.Token
+		if isEnd, err := p.nextTokenIs(token.RBRACE); err != nil {
+			return expr, errors.Join(lmerr, err)
+		} else if !isEnd {
+			if comma, err = p.expectGet(token.COMMA); err != nil {
+				return expr, errors.Join(lmerr, err)
+			}
+		}
+		if isMap {
+			ml.Entries = append(ml.Entries, util.Pair[parsetree.MapEntry, *token.Token]{First: entry, Last: comma})
+		} else {
+			ll.Elems = append(ll.Elems, util.Pair[parsetree.Expr, *token.Token]{First: elem, Last: comma})
+		}
+		if comma == nil {
+			break
+		}
+	}
+	rbrace, err := p.expectGet(token.RBRACE)
+	if err != nil {
+		return expr, errors.Join(lmerr, err)
+	}
+	if isMap {
+		ml.Rbrace = *rbrace
+		return ml, nil
+	}
+	ll.Rbrace = *rbrace
+	return ll, nil
+}
+
 func (p *ParseTreeParser) StructLiteralFields() (slfs parsetree.SeparatedList[parsetree.StructLiteralField, token.Token], err error) {
 	slfserr := errors.New("in struct literal fields")
 	for {
@@ -654,6 +1299,16 @@ func (p *ParseTreeParser) FieldAccess() (fa parsetree.Lvalue, err error) {
 		if err != nil {
 			return fa, errors.Join(faerr, err)
 		}
+		if isIndex, err := p.nextTokenIs(token.LBRACKET); err != nil {
+			return fa, errors.Join(faerr, err)
+		} else if isIndex {
+			index, err := p.Index(fa, *arrow)
+			if err != nil {
+				return fa, errors.Join(faerr, err)
+			}
+			fa = index
+			continue
+		}
 		field, err := p.expectGet(token.IDENT)
 		if err != nil {
 			return fa, errors.Join(faerr, errors.New("expected identifier with `->`"), err)
@@ -666,3 +1321,22 @@ func (p *ParseTreeParser) FieldAccess() (fa parsetree.Lvalue, err error) {
 	}
 	return fa, err
 }
+
+// Index parses the `[index]` after the `->` of an element access.
+func (p *ParseTreeParser) Index(lvalue parsetree.Lvalue, arrow token.Token) (i parsetree.Index, err error) {
+	ierr := errors.New("in index")
+	lbracket, err := p.expectGet(token.LBRACKET)
+	if err != nil {
+		return i, errors.Join(ierr, err)
+	}
+	defer p.setNoStructLiteral(p.setNoStructLiteral(false))
+	index, err := p.Expr(precedence.BOTTOM)
+	if err != nil {
+		return i, errors.Join(ierr, errors.New("expected expr"), err)
+	}
+	rbracket, err := p.expectGet(token.RBRACKET)
+	if err != nil {
+		return i, errors.Join(ierr, err)
+	}
+	return parsetree.Index{Lvalue: lvalue, Arrow: arrow, Lbracket: *lbracket, Index: index, Rbracket: *rbracket}, nil
+}
@@ -0,0 +1,160 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bigyihsuan/structlang/check"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/eval"
+	"github.com/bigyihsuan/structlang/lexer"
+	"github.com/bigyihsuan/structlang/parser"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/trees/ast"
+)
+
+const (
+	prompt       = "> "
+	continuation = ". "
+)
+
+const help = `:types  list the defined types
+:vars   list the defined variables
+:reset  forget every type and variable
+:help   show this message
+:quit   leave the repl
+`
+
+// Repl reads statements one at a time and evaluates them
+// in a single env that lives for the whole session.
+type Repl struct {
+	In        io.Reader
+	Out       io.Writer
+	Err       io.Writer
+	NoCheck   bool
+	checker   check.Checker
+	evaluator eval.Evaluator
+}
+
+func NewRepl(in io.Reader, out, err io.Writer, noCheck bool) Repl {
+	r := Repl{In: in, Out: out, Err: err, NoCheck: noCheck}
+	r.reset()
+	return r
+}
+
+func (r *Repl) reset() {
+	r.checker = check.NewChecker(nil)
+	r.evaluator = eval.NewEvaluator(nil)
+}
+
+// Run reads lines until In runs out. Lines are collected until they form complete statements,
+// so a func literal or a block can be typed over several lines.
+// A blank line gives up on waiting and reports why the input is incomplete.
+func (r *Repl) Run() error {
+	scanner := bufio.NewScanner(r.In)
+	var src strings.Builder
+	fmt.Fprint(r.Out, prompt)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if src.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			fmt.Fprint(r.Out, prompt)
+			continue
+		}
+
+		src.WriteString(line)
+		src.WriteString("\n")
+		code := src.String()
+		stmts, err := parse(code)
+		if errors.Is(err, parser.ErrOutOfTokens) && strings.TrimSpace(line) != "" {
+			fmt.Fprint(r.Out, continuation)
+			continue
+		}
+		src.Reset()
+		if err != nil {
+			diag.Render(r.Err, code, err)
+		} else {
+			r.eval(code, stmts)
+		}
+		fmt.Fprint(r.Out, prompt)
+	}
+	fmt.Fprintln(r.Out)
+	return scanner.Err()
+}
+
+// command runs a meta-command, and returns whether the repl should stop.
+func (r *Repl) command(cmd string) bool {
+	switch cmd {
+	case ":types":
+		r.evaluator.BaseEnv.DumpTypes(r.Out)
+	case ":vars":
+		r.evaluator.BaseEnv.DumpVariables(r.Out)
+	case ":reset":
+		r.reset()
+	case ":help":
+		fmt.Fprint(r.Out, help)
+	case ":quit":
+		return true
+	default:
+		fmt.Fprintf(r.Err, "unknown command `%s`, try `:help`\n", cmd)
+	}
+	return false
+}
+
+func parse(src string) ([]ast.Stmt, error) {
+	lex, _ := lexer.NewLexer(src)
+	var tokens []token.Token
+	for tok := lex.Lex(); tok.Type() != token.EOF; tok = lex.Lex() {
+		if tok.Type() == token.ILLEGAL {
+			return nil, diag.At(diag.SpanOf(&tok, &tok), "illegal character `%s`", tok.Lexeme())
+		}
+		tokens = append(tokens, tok)
+	}
+	tokens, _ = lexer.ClearComments(tokens)
+	p := parser.NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	astparser := parser.NewAstParser(tree)
+	return astparser.Parse(), nil
+}
+
+// eval checks and evaluates stmts, printing the value of every expression statement.
+func (r *Repl) eval(code string, stmts []ast.Stmt) {
+	if !r.NoCheck {
+		// check in a child scope, so that input with errors leaves nothing behind
+		scope := r.checker.BaseScope.MakeChild()
+		if err := r.checker.Check(&scope, stmts); err != nil {
+			diag.Render(r.Err, code, err)
+			return
+		}
+		for name, ty := range scope.Types {
+			r.checker.BaseScope.DefineType(name, ty)
+		}
+		for name, ty := range scope.Variables {
+			r.checker.BaseScope.DefineVariable(name, ty)
+		}
+	}
+
+	env := &r.evaluator.BaseEnv
+	for _, stmt := range stmts {
+		if exprStmt, isExpr := stmt.(ast.ExprStmt); isExpr {
+			v, err := r.evaluator.Expr(env, exprStmt.Expr)
+			if err != nil {
+				diag.Render(r.Err, code, err)
+			} else if v != nil && v.TypeName().Name != "nil" {
+				fmt.Fprintln(r.Out, v.PrintString())
+			}
+			continue
+		}
+		if _, err := r.evaluator.Evaluate(env, []ast.Stmt{stmt}); err != nil {
+			diag.Render(r.Err, code, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run feeds input to a new repl and returns what it wrote to Out and Err.
+func run(t *testing.T, input string) (out, errs string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	r := NewRepl(strings.NewReader(input), &stdout, &stderr, false)
+	done := make(chan error, 1)
+	go func() { done <- r.Run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the repl didn't finish")
+	}
+	return stdout.String(), stderr.String()
+}
+
+func TestIllegalCharacter(t *testing.T) {
+	out, errs := run(t, "let a = 1;\nlet b = a ? 2;\na + 1;\n:vars\n")
+	if !strings.Contains(errs, "1:11: error: illegal character `?`") {
+		t.Errorf("got errors %q, want an illegal character", errs)
+	}
+	// the session survives, and keeps what was defined before the mistake
+	if !strings.Contains(out, "2\n") {
+		t.Errorf("got output %q, want the statement after the mistake to run", out)
+	}
+	if !strings.Contains(out, "a int = 1\n") || strings.Contains(out, "b ") {
+		t.Errorf("got output %q, want only a to be defined", out)
+	}
+}
+
+func TestVarsPrintsValues(t *testing.T) {
+	out, _ := run(t, "let f = func(x int) int { return x; };\n:vars\n")
+	if !strings.Contains(out, "f func(int) int = func(x int) int\n") {
+		t.Errorf("got output %q, want f printed like println prints it", out)
+	}
+}
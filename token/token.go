@@ -20,6 +20,12 @@ func NewToken(tokenType TokenType, lexeme string, offset, line, column int) Toke
 	return t
 }
 
+// InFile returns t positioned in the file filename.
+func (t Token) InFile(filename string) Token {
+	t.position.Filename = filename
+	return t
+}
+
 func (t Token) Type() TokenType            { return t.type_ }
 func (t Token) Lexeme() string             { return t.lexeme }
 func (t Token) Position() gotoken.Position { return t.position }
@@ -33,6 +33,15 @@ const (
 	NOT
 	FUNC
 	RETURN
+	IF
+	ELSE
+	WHILE
+	MATCH
+	IS
+	FOR
+	IN
+	BREAK
+	CONTINUE
 	keywords_end
 
 	symbols_begin
@@ -43,6 +52,7 @@ const (
 	LPAREN
 	RPAREN
 	PERIOD
+	DOTDOT
 	COMMA
 	SEMICOLON
 	COLON
@@ -52,6 +62,7 @@ const (
 	MINUS
 	STAR
 	SLASH
+	PERCENT
 	GT
 	LT
 	// EQ (double equal?)
@@ -73,18 +84,27 @@ var tokens = [...]string{
 	// BOOL_FALSE: "FALSE",
 	STRING: "STRING",
 
-	STRUCT: "struct",
-	TYPE:   "type",
-	LET:    "let",
-	SET:    "set",
-	TRUE:   "true",
-	FALSE:  "false",
-	NIL:    "nil",
-	AND:    "and",
-	OR:     "or",
-	NOT:    "not",
-	FUNC:   "func",
-	RETURN: "return",
+	STRUCT:   "struct",
+	TYPE:     "type",
+	LET:      "let",
+	SET:      "set",
+	TRUE:     "true",
+	FALSE:    "false",
+	NIL:      "nil",
+	AND:      "and",
+	OR:       "or",
+	NOT:      "not",
+	FUNC:     "func",
+	RETURN:   "return",
+	IF:       "if",
+	ELSE:     "else",
+	WHILE:    "while",
+	MATCH:    "match",
+	IS:       "is",
+	FOR:      "for",
+	IN:       "in",
+	BREAK:    "break",
+	CONTINUE: "continue",
 
 	LBRACKET:  "[",
 	RBRACKET:  "]",
@@ -93,6 +113,7 @@ var tokens = [...]string{
 	LPAREN:    "(",
 	RPAREN:    ")",
 	PERIOD:    ".",
+	DOTDOT:    "..",
 	COMMA:     ",",
 	SEMICOLON: ";",
 	COLON:     ":",
@@ -102,6 +123,7 @@ var tokens = [...]string{
 	MINUS:     "-",
 	STAR:      "*",
 	SLASH:     "/",
+	PERCENT:   "%",
 	GT:        ">",
 	LT:        "<",
 	// EQ (double equal?): "",
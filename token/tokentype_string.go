@@ -32,34 +32,45 @@ func _() {
 	_ = x[NOT-20]
 	_ = x[FUNC-21]
 	_ = x[RETURN-22]
-	_ = x[keywords_end-23]
-	_ = x[symbols_begin-24]
-	_ = x[LBRACKET-25]
-	_ = x[RBRACKET-26]
-	_ = x[LBRACE-27]
-	_ = x[RBRACE-28]
-	_ = x[LPAREN-29]
-	_ = x[RPAREN-30]
-	_ = x[PERIOD-31]
-	_ = x[COMMA-32]
-	_ = x[SEMICOLON-33]
-	_ = x[COLON-34]
-	_ = x[EQ-35]
-	_ = x[ARROW-36]
-	_ = x[PLUS-37]
-	_ = x[MINUS-38]
-	_ = x[STAR-39]
-	_ = x[SLASH-40]
-	_ = x[GT-41]
-	_ = x[LT-42]
-	_ = x[GTEQ-43]
-	_ = x[LTEQ-44]
-	_ = x[symbols_end-45]
+	_ = x[IF-23]
+	_ = x[ELSE-24]
+	_ = x[WHILE-25]
+	_ = x[MATCH-26]
+	_ = x[IS-27]
+	_ = x[FOR-28]
+	_ = x[IN-29]
+	_ = x[BREAK-30]
+	_ = x[CONTINUE-31]
+	_ = x[keywords_end-32]
+	_ = x[symbols_begin-33]
+	_ = x[LBRACKET-34]
+	_ = x[RBRACKET-35]
+	_ = x[LBRACE-36]
+	_ = x[RBRACE-37]
+	_ = x[LPAREN-38]
+	_ = x[RPAREN-39]
+	_ = x[PERIOD-40]
+	_ = x[DOTDOT-41]
+	_ = x[COMMA-42]
+	_ = x[SEMICOLON-43]
+	_ = x[COLON-44]
+	_ = x[EQ-45]
+	_ = x[ARROW-46]
+	_ = x[PLUS-47]
+	_ = x[MINUS-48]
+	_ = x[STAR-49]
+	_ = x[SLASH-50]
+	_ = x[PERCENT-51]
+	_ = x[GT-52]
+	_ = x[LT-53]
+	_ = x[GTEQ-54]
+	_ = x[LTEQ-55]
+	_ = x[symbols_end-56]
 }
 
-const _TokenType_name = "NOT_FOUNDILLEGALWHITESPACECOMMENTEOFIDENTliterals_beginINTFLOATSTRINGliterals_endkeywords_beginSTRUCTTYPELETSETTRUEFALSENILANDORNOTFUNCRETURNkeywords_endsymbols_beginLBRACKETRBRACKETLBRACERBRACELPARENRPARENPERIODCOMMASEMICOLONCOLONEQARROWPLUSMINUSSTARSLASHGTLTGTEQLTEQsymbols_end"
+const _TokenType_name = "NOT_FOUNDILLEGALWHITESPACECOMMENTEOFIDENTliterals_beginINTFLOATSTRINGliterals_endkeywords_beginSTRUCTTYPELETSETTRUEFALSENILANDORNOTFUNCRETURNIFELSEWHILEMATCHISFORINBREAKCONTINUEkeywords_endsymbols_beginLBRACKETRBRACKETLBRACERBRACELPARENRPARENPERIODDOTDOTCOMMASEMICOLONCOLONEQARROWPLUSMINUSSTARSLASHPERCENTGTLTGTEQLTEQsymbols_end"
 
-var _TokenType_index = [...]uint16{0, 9, 16, 26, 33, 36, 41, 55, 58, 63, 69, 81, 95, 101, 105, 108, 111, 115, 120, 123, 126, 128, 131, 135, 141, 153, 166, 174, 182, 188, 194, 200, 206, 212, 217, 226, 231, 233, 238, 242, 247, 251, 256, 258, 260, 264, 268, 279}
+var _TokenType_index = [...]uint16{0, 9, 16, 26, 33, 36, 41, 55, 58, 63, 69, 81, 95, 101, 105, 108, 111, 115, 120, 123, 126, 128, 131, 135, 141, 143, 147, 152, 157, 159, 162, 164, 169, 177, 189, 202, 210, 218, 224, 230, 236, 242, 248, 254, 259, 268, 273, 275, 280, 284, 289, 293, 298, 305, 307, 309, 313, 317, 328}
 
 func (i TokenType) String() string {
 	i -= -1
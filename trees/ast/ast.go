@@ -31,6 +31,7 @@ type Tokens struct {
 type TypeDef struct {
 	Type      Type
 	StructDef StructDef
+	Alias     *Type // the aliased type, instead of StructDef
 	Tokens
 }
 
@@ -74,6 +75,18 @@ func (fa FieldAccess) lvalueTag()             {}
 func (fa FieldAccess) FirstTok() *token.Token { return fa.Lvalue.FirstTok() }
 func (fa FieldAccess) LastTok() *token.Token  { return fa.Field.LastToken }
 
+// Index is the element of a list at an index, like `xs->[0]`.
+type Index struct {
+	Lvalue Lvalue
+	Index  Expr
+	Tokens
+}
+
+func (i Index) exprTag()               {}
+func (i Index) lvalueTag()             {}
+func (i Index) FirstTok() *token.Token { return i.FirstToken }
+func (i Index) LastTok() *token.Token  { return i.LastToken }
+
 type Type struct {
 	Name Ident
 	Vars []Type
@@ -92,12 +105,16 @@ type StructDef struct {
 func (sd StructDef) FirstTok() *token.Token { return sd.FirstToken }
 func (sd StructDef) LastTok() *token.Token  { return sd.LastToken }
 
+// StructField is a list of names sharing a type, or an embedded field if there are no names.
+// An embedded field is named after its type, and its fields are promoted to the outer struct.
 type StructField struct {
 	Names []Ident
 	Type  Type
 	Tokens
 }
 
+func (sf StructField) IsEmbedded() bool { return len(sf.Names) == 0 }
+
 func (sf StructField) FirstTok() *token.Token { return sf.FirstToken }
 func (sf StructField) LastTok() *token.Token  { return sf.LastToken }
 
@@ -130,6 +147,36 @@ type StructLiteralField struct {
 func (slf StructLiteralField) FirstTok() *token.Token { return slf.FirstToken }
 func (slf StructLiteralField) LastTok() *token.Token  { return slf.LastToken }
 
+// ListLiteral builds a list from its elements, like `list[int]{1, 2, 3}`.
+type ListLiteral struct {
+	TypeName Type
+	Elems    []Expr
+	Tokens
+}
+
+func (ll ListLiteral) exprTag()               {}
+func (ll ListLiteral) FirstTok() *token.Token { return ll.FirstToken }
+func (ll ListLiteral) LastTok() *token.Token  { return ll.LastToken }
+
+// MapLiteral builds a map from its entries, like `map[string, int]{"one": 1}`.
+type MapLiteral struct {
+	TypeName Type
+	Entries  []MapEntry
+	Tokens
+}
+
+func (ml MapLiteral) exprTag()               {}
+func (ml MapLiteral) FirstTok() *token.Token { return ml.FirstToken }
+func (ml MapLiteral) LastTok() *token.Token  { return ml.LastToken }
+
+type MapEntry struct {
+	Key, Value Expr
+	Tokens
+}
+
+func (me MapEntry) FirstTok() *token.Token { return me.FirstToken }
+func (me MapEntry) LastTok() *token.Token  { return me.LastToken }
+
 type Literal struct {
 	token.Token
 	Tokens
@@ -170,8 +217,9 @@ func (ge GroupingExpr) FirstTok() *token.Token { return ge.FirstToken }
 func (ge GroupingExpr) LastTok() *token.Token  { return ge.LastToken }
 
 type FuncCallExpr struct {
-	Name Lvalue
-	Args []Expr
+	Name     Lvalue
+	TypeArgs []Type // given when calling a generic function, and inferred from Args otherwise
+	Args     []Expr
 	Tokens
 }
 
@@ -180,9 +228,11 @@ func (fce FuncCallExpr) FirstTok() *token.Token { return fce.FirstToken }
 func (fce FuncCallExpr) LastTok() *token.Token  { return fce.LastToken }
 
 type FuncDef struct {
+	TypeParams []Type
 	Args       []FuncArg
 	ReturnType *Type
 	Body       []Stmt
+	Broken     bool // statements with syntax errors were left out of Body
 	Tokens
 }
 
@@ -190,6 +240,20 @@ func (fd FuncDef) exprTag()               {}
 func (fd FuncDef) FirstTok() *token.Token { return fd.FirstToken }
 func (fd FuncDef) LastTok() *token.Token  { return fd.LastToken }
 
+// MethodDef declares a method on the type of its receiver.
+// Func is the method as a function: the receiver is its first argument,
+// and the type parameters of a generic receiver type come before its own.
+type MethodDef struct {
+	Receiver FuncArg
+	Name     Ident
+	Func     FuncDef
+	Tokens
+}
+
+func (md MethodDef) stmtTag()               {}
+func (md MethodDef) FirstTok() *token.Token { return md.FirstToken }
+func (md MethodDef) LastTok() *token.Token  { return md.LastToken }
+
 type FuncArg struct {
 	Name Ident
 	Type Type
@@ -203,3 +267,103 @@ type ReturnStmt struct {
 func (rs ReturnStmt) stmtTag()               {}
 func (rs ReturnStmt) FirstTok() *token.Token { return rs.FirstToken }
 func (rs ReturnStmt) LastTok() *token.Token  { return rs.LastToken }
+
+type Block struct {
+	Stmts []Stmt
+	Tokens
+}
+
+func (b Block) FirstTok() *token.Token { return b.FirstToken }
+func (b Block) LastTok() *token.Token  { return b.LastToken }
+
+type IfStmt struct {
+	Cond Expr
+	Then Block
+	Else *Block // `else if` is an else block holding a single IfStmt
+	Tokens
+}
+
+func (is IfStmt) stmtTag()               {}
+func (is IfStmt) FirstTok() *token.Token { return is.FirstToken }
+func (is IfStmt) LastTok() *token.Token  { return is.LastToken }
+
+type WhileStmt struct {
+	Cond Expr
+	Body Block
+	Tokens
+}
+
+func (ws WhileStmt) stmtTag()               {}
+func (ws WhileStmt) FirstTok() *token.Token { return ws.FirstToken }
+func (ws WhileStmt) LastTok() *token.Token  { return ws.LastToken }
+
+// ForStmt runs Body for every element of Iterable, or for every int from Iterable up to End if End is set.
+type ForStmt struct {
+	Index    *Ident // the position of the element, or the key of a map
+	Elem     Ident
+	Iterable Expr
+	End      Expr
+	Body     Block
+	Tokens
+}
+
+func (fs ForStmt) stmtTag()               {}
+func (fs ForStmt) FirstTok() *token.Token { return fs.FirstToken }
+func (fs ForStmt) LastTok() *token.Token  { return fs.LastToken }
+
+type BreakStmt struct {
+	Tokens
+}
+
+func (bs BreakStmt) stmtTag()               {}
+func (bs BreakStmt) FirstTok() *token.Token { return bs.FirstToken }
+func (bs BreakStmt) LastTok() *token.Token  { return bs.LastToken }
+
+type ContinueStmt struct {
+	Tokens
+}
+
+func (cs ContinueStmt) stmtTag()               {}
+func (cs ContinueStmt) FirstTok() *token.Token { return cs.FirstToken }
+func (cs ContinueStmt) LastTok() *token.Token  { return cs.LastToken }
+
+type MatchStmt struct {
+	Subject Expr
+	Arms    []MatchArm
+	Tokens
+}
+
+func (ms MatchStmt) stmtTag()               {}
+func (ms MatchStmt) FirstTok() *token.Token { return ms.FirstToken }
+func (ms MatchStmt) LastTok() *token.Token  { return ms.LastToken }
+
+type MatchArm struct {
+	Binding *Ident
+	Type    Type
+	Body    Block
+	Tokens
+}
+
+func (ma MatchArm) FirstTok() *token.Token { return ma.FirstToken }
+func (ma MatchArm) LastTok() *token.Token  { return ma.LastToken }
+
+// Instantiation is a generic function given its type arguments, like `id[int]`.
+type Instantiation struct {
+	Name     Ident
+	TypeArgs []Type
+	Tokens
+}
+
+func (i Instantiation) exprTag()               {}
+func (i Instantiation) FirstTok() *token.Token { return i.FirstToken }
+func (i Instantiation) LastTok() *token.Token  { return i.LastToken }
+
+type IsExpr struct {
+	Left Expr
+	Type Type
+	Tokens
+}
+
+func (ie IsExpr) exprTag()               {}
+func (ie IsExpr) FirstTok() *token.Token { return ie.FirstToken }
+func (ie IsExpr) LastTok() *token.Token  { return ie.LastToken }
@@ -64,6 +64,19 @@ func (fa FieldAccess) exprTag()       {}
 func (fa FieldAccess) lvalueTag()     {}
 func (fa FieldAccess) String() string { return fmt.Sprintf("(-> %s %s)", fa.Lvalue, fa.Field) }
 
+// Index is the element of a list at an index, like `xs->[0]`.
+type Index struct {
+	Lvalue   Lvalue
+	Arrow    token.Token
+	Lbracket token.Token
+	Index    Expr
+	Rbracket token.Token
+}
+
+func (i Index) exprTag()       {}
+func (i Index) lvalueTag()     {}
+func (i Index) String() string { return fmt.Sprintf("(->[] %s %s)", i.Lvalue, i.Index) }
+
 type StructLiteral struct {
 	TypeName Type
 	Lbrace   token.Token
@@ -92,6 +105,50 @@ func (slf StructLiteralField) String() string {
 	return fmt.Sprintf("(%s:%s)", slf.FieldName, slf.Value)
 }
 
+// ListLiteral is a struct literal of a list, which gives its elements in order instead of fields.
+type ListLiteral struct {
+	TypeName Type
+	Lbrace   token.Token
+	Elems    SeparatedList[Expr, token.Token]
+	Rbrace   token.Token
+}
+
+func (ll ListLiteral) exprTag() {}
+func (ll ListLiteral) String() string {
+	elems := []string{}
+	for _, pair := range ll.Elems {
+		elems = append(elems, pair.First.String())
+	}
+	return fmt.Sprintf("(%s {%s})", ll.TypeName, strings.Join(elems, " "))
+}
+
+// MapLiteral is a struct literal of a map, which gives its entries as `key: value`.
+type MapLiteral struct {
+	TypeName Type
+	Lbrace   token.Token
+	Entries  SeparatedList[MapEntry, token.Token]
+	Rbrace   token.Token
+}
+
+func (ml MapLiteral) exprTag() {}
+func (ml MapLiteral) String() string {
+	entries := []string{}
+	for _, pair := range ml.Entries {
+		entries = append(entries, pair.First.String())
+	}
+	return fmt.Sprintf("(%s {%s})", ml.TypeName, strings.Join(entries, " "))
+}
+
+type MapEntry struct {
+	Key   Expr
+	Colon token.Token
+	Value Expr
+}
+
+func (me MapEntry) String() string {
+	return fmt.Sprintf("(%s:%s)", me.Key, me.Value)
+}
+
 type Literal struct {
 	token.Token
 }
@@ -113,23 +170,50 @@ type TypeDef struct {
 	TypeName  Type
 	Eq        token.Token
 	StructDef StructDef
+	Alias     *Type // the aliased type, instead of StructDef
 	Sc        token.Token
 }
 
 func (td TypeDef) stmtTag() {}
 func (td TypeDef) String() string {
+	if td.Alias != nil {
+		return fmt.Sprintf("(type %s = %s ;)", td.TypeName, td.Alias)
+	}
 	return fmt.Sprintf("(type %s = %s ;)", td.TypeName, td.StructDef)
 }
 
+// Type is a named type with optional type vars, or a function type if Func is set.
+// The TypeName of a function type is its `func` keyword.
 type Type struct {
 	TypeName Ident
 	TypeVars *TypeVars
+	Func     *FuncType
 }
 
 func (t Type) String() string {
+	if t.Func != nil {
+		return t.Func.String()
+	}
 	return fmt.Sprintf("(%s%s)", t.TypeName, t.TypeVars)
 }
 
+// FuncType is the type of a function, like `func(int, string) bool`.
+type FuncType struct {
+	FuncKw token.Token
+	Lparen token.Token
+	Params SeparatedList[Type, token.Token] // Type and comma
+	Rparen token.Token
+	Return *Type
+}
+
+func (ft FuncType) String() string {
+	params := []string{}
+	for _, pair := range ft.Params {
+		params = append(params, pair.First.String())
+	}
+	return fmt.Sprintf("(func (%s) %s)", params, ft.Return)
+}
+
 type TypeVars struct {
 	Lbracket token.Token
 	TypeVars SeparatedList[Type, token.Token] // Type and comma
@@ -162,7 +246,7 @@ func (sd StructDef) String() string {
 }
 
 type StructField struct {
-	Names SeparatedList[Ident, token.Token] // ident and comma
+	Names SeparatedList[Ident, token.Token] // ident and comma; empty for an embedded field
 	Type  Type
 	Sc    *token.Token
 }
@@ -209,10 +293,11 @@ func (ge GroupingExpr) String() string {
 }
 
 type FuncCallExpr struct {
-	Name   Lvalue
-	Lparen token.Token
-	Args   SeparatedList[Expr, token.Token]
-	Rparen token.Token
+	Name     Lvalue
+	TypeVars *TypeVars // the type arguments of a generic function
+	Lparen   token.Token
+	Args     SeparatedList[Expr, token.Token]
+	Rparen   token.Token
 }
 
 func (fce FuncCallExpr) exprTag() {}
@@ -222,11 +307,23 @@ func (fce FuncCallExpr) String() string {
 		arg := pair.First
 		args = append(args, arg.String())
 	}
-	return fmt.Sprintf("(%s (%s))", fce.Name, strings.Join(args, " "))
+	return fmt.Sprintf("(%s%s (%s))", fce.Name, fce.TypeVars, strings.Join(args, " "))
+}
+
+// Instantiation is a generic function given its type arguments, like `id[int]`.
+type Instantiation struct {
+	Name     Ident
+	TypeVars TypeVars
+}
+
+func (i Instantiation) exprTag() {}
+func (i Instantiation) String() string {
+	return fmt.Sprintf("(%s%s)", i.Name, i.TypeVars)
 }
 
 type FuncDef struct {
 	FuncKw     token.Token
+	TypeVars   *TypeVars // the type parameters of a generic function
 	Lparen     token.Token
 	Args       SeparatedList[FuncArg, token.Token]
 	Rparen     token.Token
@@ -234,6 +331,7 @@ type FuncDef struct {
 	Lbrace     token.Token
 	Body       []Stmt
 	Rbrace     token.Token
+	Broken     bool // statements with syntax errors were left out of Body
 }
 
 func (fd FuncDef) exprTag() {}
@@ -247,7 +345,23 @@ func (fd FuncDef) String() string {
 	for _, stmt := range fd.Body {
 		body = append(body, stmt.String())
 	}
-	return fmt.Sprintf("(func (%s) %s {%s})", args, fd.ReturnType, body)
+	return fmt.Sprintf("(func%s (%s) %s {%s})", fd.TypeVars, args, fd.ReturnType, body)
+}
+
+// MethodDef declares a method on the type of its receiver, like `func (p point) norm() float { ... }`.
+// Func is the rest of the declaration after the name, and shares its `func` keyword.
+type MethodDef struct {
+	FuncKw   token.Token
+	Lparen   token.Token
+	Receiver FuncArg
+	Rparen   token.Token
+	Name     Ident
+	Func     FuncDef
+}
+
+func (md MethodDef) stmtTag() {}
+func (md MethodDef) String() string {
+	return fmt.Sprintf("(method %s %s %s)", md.Receiver, md.Name, md.Func)
 }
 
 type FuncArg struct {
@@ -273,3 +387,142 @@ func (rs ReturnStmt) String() string {
 		return "(return ;)"
 	}
 }
+
+type Block struct {
+	Lbrace token.Token
+	Stmts  []Stmt
+	Rbrace token.Token
+}
+
+func (b Block) String() string {
+	stmts := []string{}
+	for _, stmt := range b.Stmts {
+		stmts = append(stmts, stmt.String())
+	}
+	return fmt.Sprintf("{%s}", strings.Join(stmts, " "))
+}
+
+type IfStmt struct {
+	IfKw token.Token
+	Cond Expr
+	Then Block
+	Else *ElseClause
+}
+
+func (is IfStmt) stmtTag() {}
+func (is IfStmt) String() string {
+	if is.Else != nil {
+		return fmt.Sprintf("(if %s %s %s)", is.Cond, is.Then, is.Else)
+	} else {
+		return fmt.Sprintf("(if %s %s)", is.Cond, is.Then)
+	}
+}
+
+type ElseClause struct {
+	ElseKw token.Token
+	If     *IfStmt // set for `else if`, otherwise Block is set
+	Block  *Block
+}
+
+func (ec ElseClause) String() string {
+	if ec.If != nil {
+		return fmt.Sprintf("(else %s)", ec.If)
+	} else {
+		return fmt.Sprintf("(else %s)", ec.Block)
+	}
+}
+
+type WhileStmt struct {
+	WhileKw token.Token
+	Cond    Expr
+	Body    Block
+}
+
+func (ws WhileStmt) stmtTag() {}
+func (ws WhileStmt) String() string {
+	return fmt.Sprintf("(while %s %s)", ws.Cond, ws.Body)
+}
+
+// ForStmt is `for x in iterable { ... }`, or `for i, x in iterable { ... }` which also names the position of x.
+type ForStmt struct {
+	ForKw    token.Token
+	Index    *Ident // set when two names are given
+	Comma    *token.Token
+	Elem     Ident
+	InKw     token.Token
+	Iterable Expr
+	DotDot   *token.Token // set for the range `Iterable..End`
+	End      Expr
+	Body     Block
+}
+
+func (fs ForStmt) stmtTag() {}
+func (fs ForStmt) String() string {
+	names := fs.Elem.String()
+	if fs.Index != nil {
+		names = fmt.Sprintf("%s %s", fs.Index, fs.Elem)
+	}
+	iterable := fs.Iterable.String()
+	if fs.DotDot != nil {
+		iterable = fmt.Sprintf("(.. %s %s)", fs.Iterable, fs.End)
+	}
+	return fmt.Sprintf("(for %s in %s %s)", names, iterable, fs.Body)
+}
+
+type BreakStmt struct {
+	BreakKw token.Token
+	Sc      token.Token
+}
+
+func (bs BreakStmt) stmtTag()       {}
+func (bs BreakStmt) String() string { return "(break ;)" }
+
+type ContinueStmt struct {
+	ContinueKw token.Token
+	Sc         token.Token
+}
+
+func (cs ContinueStmt) stmtTag()       {}
+func (cs ContinueStmt) String() string { return "(continue ;)" }
+
+type MatchStmt struct {
+	MatchKw token.Token
+	Subject Expr
+	Lbrace  token.Token
+	Arms    []MatchArm
+	Rbrace  token.Token
+}
+
+func (ms MatchStmt) stmtTag() {}
+func (ms MatchStmt) String() string {
+	arms := []string{}
+	for _, arm := range ms.Arms {
+		arms = append(arms, arm.String())
+	}
+	return fmt.Sprintf("(match %s {%s})", ms.Subject, strings.Join(arms, " "))
+}
+
+type MatchArm struct {
+	Binding *Ident // the name the unwrapped value is bound to, if any
+	Type    Type
+	Body    Block
+}
+
+func (ma MatchArm) String() string {
+	if ma.Binding != nil {
+		return fmt.Sprintf("(%s %s %s)", ma.Binding, ma.Type, ma.Body)
+	} else {
+		return fmt.Sprintf("(%s %s)", ma.Type, ma.Body)
+	}
+}
+
+type IsExpr struct {
+	Left Expr
+	IsKw token.Token
+	Type Type
+}
+
+func (ie IsExpr) exprTag() {}
+func (ie IsExpr) String() string {
+	return fmt.Sprintf("(is %s %s)", ie.Left, ie.Type)
+}
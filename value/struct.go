@@ -2,13 +2,16 @@ package value
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 type Struct struct {
-	Name       string
+	Type       TypeName // the instantiated type, like `tree[int]`
 	TypeParams map[string]TypeName
 	Fields     map[string]Value
+	FieldTypes map[string]TypeName // the declared types of the fields, with the type params filled in
+	Embedded   []string            // the embedded fields, whose fields are promoted
 	IsReturn   bool
 }
 
@@ -19,9 +22,11 @@ func NewStruct(fields map[string]Value) (sv Struct) {
 	}
 	return
 }
-func NewStructFromType(template Type, typeParams map[string]TypeName, fields map[string]Value, typeName string) (sv Struct) {
+func NewStructFromType(template Type, typeParams map[string]TypeName, fields map[string]Value, typeName TypeName) (sv Struct) {
 	sv.TypeParams = typeParams
-	sv.Name = typeName
+	sv.Type = typeName
+	sv.FieldTypes = template.Fields
+	sv.Embedded = template.Embedded
 	sv.Fields = make(map[string]Value)
 	for name := range template.Fields {
 		var v Value
@@ -33,12 +38,82 @@ func NewStructFromType(template Type, typeParams map[string]TypeName, fields map
 	return
 }
 
+// Copier is a value that holds other values, which Copy has to copy too.
+type Copier interface {
+	Copy() Value
+}
+
+// Copy returns a deep copy of v. Structs are values, not references: every variable, argument
+// and field holds its own copy, so setting a field through one never shows through another.
+// Functions aren't copied, and keep sharing the env they captured.
+func Copy(v Value) Value {
+	switch v := v.(type) {
+	case Struct:
+		return v.deepCopy()
+	case Copier:
+		return v.Copy()
+	}
+	return v
+}
+
+// deepCopy isn't Copier's Copy, so that it isn't promoted to the primitives that embed Struct.
+func (sv Struct) deepCopy() Struct {
+	fields := make(map[string]Value, len(sv.Fields))
+	for name, value := range sv.Fields {
+		if value != nil {
+			value = Copy(value)
+		}
+		fields[name] = value
+	}
+	sv.Fields = fields
+	return sv
+}
+
+// Get gets a field of sv, or the promoted field of one of its embedded structs.
 func (sv Struct) Get(field string) Value {
-	return sv.Fields[field]
+	switch owner := sv.Owner(field).(type) {
+	case nil:
+		return nil
+	case Struct:
+		return owner.Fields[field]
+	default:
+		return owner.Get(field)
+	}
+}
+
+// Owner returns the value that has field itself: sv, or the closest embedded value that has it.
+// It returns nil if there is no such field.
+func (sv Struct) Owner(field string) Value {
+	if _, ok := sv.Fields[field]; ok {
+		return sv
+	}
+	level := []Struct{sv}
+	for len(level) > 0 {
+		next := []Struct{}
+		for _, outer := range level {
+			for _, name := range outer.Embedded {
+				switch inner := outer.Fields[name].(type) {
+				case nil:
+				case Struct:
+					if _, ok := inner.Fields[field]; ok {
+						return inner
+					}
+					next = append(next, inner)
+				default:
+					// an embedded primitive
+					if inner.Get(field) != nil {
+						return inner
+					}
+				}
+			}
+		}
+		level = next
+	}
+	return nil
 }
 
 func (sv Struct) TypeName() TypeName {
-	return TypeName{Name: sv.Name}
+	return sv.Type
 }
 func (sv Struct) Unwrap() any {
 	// TODO: what is this unwrapped?
@@ -53,9 +128,10 @@ func (sv Struct) PrintString() string {
 	for name, value := range sv.Fields {
 		fields = append(fields, name+":"+value.PrintString())
 	}
+	sort.Strings(fields)
 	fieldStr := ""
 	if len(fields) > 0 {
 		fieldStr = strings.Join(fields, ", ")
 	}
-	return fmt.Sprintf("%s{%s}", sv.Name, fieldStr)
+	return fmt.Sprintf("%s{%s}", sv.Type, fieldStr)
 }
@@ -2,16 +2,32 @@ package value
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 type TypeName struct {
-	Name string
-	Vars []TypeName
+	Name   string
+	Vars   []TypeName
+	Params []string // the type parameters of a generic function type, which its Vars can use
 }
 
 func (tn TypeName) String() string {
 	name := tn.Name
+	if params, ret, isFunc := tn.FuncParts(); isFunc {
+		ps := []string{}
+		for _, p := range params {
+			ps = append(ps, p.String())
+		}
+		generic := ""
+		if tn.IsGeneric() {
+			generic = fmt.Sprintf("[%s]", strings.Join(tn.Params, ","))
+		}
+		if ret.Name == "nil" {
+			return fmt.Sprintf("func%s(%s)", generic, strings.Join(ps, ","))
+		}
+		return fmt.Sprintf("func%s(%s) %s", generic, strings.Join(ps, ","), ret)
+	}
 	vars := []string{}
 	for _, v := range tn.Vars {
 		vars = append(vars, v.String())
@@ -23,16 +39,231 @@ func (tn TypeName) String() string {
 	}
 }
 
+// Equal reports whether tn and other name the same type with the same type arguments,
+// so `tree[int]` and `tree[string]` are different types.
+func (tn TypeName) Equal(other TypeName) bool {
+	if tn.Name != other.Name || len(tn.Vars) != len(other.Vars) || len(tn.Params) != len(other.Params) {
+		return false
+	}
+	for i := range tn.Params {
+		if tn.Params[i] != other.Params[i] {
+			return false
+		}
+	}
+	for i := range tn.Vars {
+		if !tn.Vars[i].Equal(other.Vars[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Substitute replaces every type variable in tn, at any depth, with its concrete type.
+// `either[tree[T],nil]` with `T = int` becomes `either[tree[int],nil]`.
+func (tn TypeName) Substitute(params map[string]TypeName) TypeName {
+	if concrete, ok := params[tn.Name]; ok && len(tn.Vars) == 0 {
+		return concrete
+	}
+	if tn.IsGeneric() {
+		// the type parameters of a generic function hide the outer ones
+		inner := make(map[string]TypeName)
+		for name, concrete := range params {
+			inner[name] = concrete
+		}
+		for _, param := range tn.Params {
+			delete(inner, param)
+		}
+		params = inner
+	}
+	vars := []TypeName{}
+	for _, v := range tn.Vars {
+		vars = append(vars, v.Substitute(params))
+	}
+	return TypeName{Name: tn.Name, Vars: vars, Params: tn.Params}
+}
+
+// Resolve replaces the aliases in tn, at any depth, with the types they stand for.
+// lookup finds a type by name.
+func (tn TypeName) Resolve(lookup func(name string) *Type) TypeName {
+	seen := map[string]bool{}
+	for t := lookup(tn.Name); t != nil && t.Alias != nil && !seen[tn.Name]; t = lookup(tn.Name) {
+		// an alias of itself would never stop
+		seen[tn.Name] = true
+		tn = t.Alias.Substitute(t.Params(tn.Vars))
+	}
+	if tn.IsGeneric() {
+		lookup = hiding(lookup, tn.Params)
+	}
+	vars := []TypeName{}
+	for _, v := range tn.Vars {
+		vars = append(vars, v.Resolve(lookup))
+	}
+	return TypeName{Name: tn.Name, Vars: vars, Params: tn.Params}
+}
+
+// hiding wraps lookup so that it doesn't find the types named by params,
+// which are type parameters hiding any type with the same name.
+func hiding(lookup func(name string) *Type, params []string) func(name string) *Type {
+	return func(name string) *Type {
+		for _, param := range params {
+			if name == param {
+				return nil
+			}
+		}
+		return lookup(name)
+	}
+}
+
+// FuncType builds the type of a function: `func` whose type vars are the
+// parameter types followed by the return type, which is `nil` if it returns nothing.
+func FuncType(params []TypeName, ret TypeName) TypeName {
+	vars := append([]TypeName{}, params...)
+	return TypeName{Name: "func", Vars: append(vars, ret)}
+}
+
+// FuncParts splits a function type into its parameter types and its return type.
+func (tn TypeName) FuncParts() (params []TypeName, ret TypeName, ok bool) {
+	if !tn.IsFunc() || len(tn.Vars) == 0 {
+		return nil, TypeName{}, false
+	}
+	return tn.Vars[:len(tn.Vars)-1], tn.Vars[len(tn.Vars)-1], true
+}
+
+func (tn TypeName) IsFunc() bool {
+	return tn.Name == "func"
+}
+
+// IsGeneric reports whether tn is the type of a generic function, which has to be instantiated to be called.
+func (tn TypeName) IsGeneric() bool {
+	return len(tn.Params) > 0
+}
+
+// Instantiate fills in the type parameters of a generic function type with typeArgs.
+func (tn TypeName) Instantiate(typeArgs []TypeName) (TypeName, error) {
+	if len(typeArgs) != len(tn.Params) {
+		return tn, fmt.Errorf("wrong number of type parameters for `%s`: want %d, got %d", tn, len(tn.Params), len(typeArgs))
+	}
+	params := make(map[string]TypeName)
+	for i, param := range tn.Params {
+		params[param] = typeArgs[i]
+	}
+	vars := []TypeName{}
+	for _, v := range tn.Vars {
+		vars = append(vars, v.Substitute(params))
+	}
+	return TypeName{Name: tn.Name, Vars: vars}, nil
+}
+
+// Infer finds the type arguments of a generic function type from the types of the arguments it is called with.
+func (tn TypeName) Infer(args []TypeName) ([]TypeName, error) {
+	params, _, _ := tn.FuncParts()
+	bindings := make(map[string]TypeName)
+	for i := range params {
+		if i < len(args) {
+			tn.bind(params[i], args[i], bindings)
+		}
+	}
+	typeArgs := []TypeName{}
+	for _, param := range tn.Params {
+		bound, ok := bindings[param]
+		if !ok {
+			return nil, fmt.Errorf("cannot infer type parameter `%s` of `%s`", param, tn)
+		}
+		typeArgs = append(typeArgs, bound)
+	}
+	return typeArgs, nil
+}
+
+// bind matches want, which can use the type parameters of tn, against got,
+// binding the parameters that aren't bound yet to the parts of got they stand for.
+func (tn TypeName) bind(want, got TypeName, bindings map[string]TypeName) {
+	for _, param := range tn.Params {
+		if want.Name == param && len(want.Vars) == 0 {
+			if _, bound := bindings[param]; !bound {
+				bindings[param] = got
+			}
+			return
+		}
+	}
+	if want.Name != got.Name || len(want.Vars) != len(got.Vars) {
+		return
+	}
+	for i := range want.Vars {
+		tn.bind(want.Vars[i], got.Vars[i], bindings)
+	}
+}
+
+// ListType is the type of a list whose elements are elem.
+func ListType(elem TypeName) TypeName {
+	return TypeName{Name: "list", Vars: []TypeName{elem}}
+}
+
+// IsList reports whether tn is an instance of the builtin `list[T]`.
+// Its only type var is the type of the elements.
+func (tn TypeName) IsList() bool {
+	return tn.Name == "list" && len(tn.Vars) == 1
+}
+
+// MapType is the type of a map from keys of type key to values of type val.
+func MapType(key, val TypeName) TypeName {
+	return TypeName{Name: "map", Vars: []TypeName{key, val}}
+}
+
+// IsMap reports whether tn is an instance of the builtin `map[K,V]`.
+// Its type vars are the types of the keys and the values.
+func (tn TypeName) IsMap() bool {
+	return tn.Name == "map" && len(tn.Vars) == 2
+}
+
+// IsEither reports whether tn is an instance of the builtin `either[T,U]`.
+// Its type vars are the alternatives.
+func (tn TypeName) IsEither() bool {
+	return tn.Name == "either"
+}
+
 type Type struct {
-	Fields map[string]TypeName
-	Vars   []TypeName // positional typeargs
+	Fields   map[string]TypeName
+	Vars     []TypeName // positional typeargs
+	Embedded []string   // the fields that are embedded, which are named after their type
+	Alias    *TypeName  // the type this is another name for, which has no fields of its own
+	Methods  map[string]Method
+}
+
+// Method is a function declared on a type, which gets the value it is called on as its first argument.
+type Method struct {
+	Type  TypeName // the type of the function, receiver included
+	Value Value    // the function itself, which only exists at runtime
+}
+
+// WithMethod returns a copy of s that also has the method name.
+func (s Type) WithMethod(name string, method Method) Type {
+	o := s.Copy()
+	o.Methods[name] = method
+	return o
+}
+
+func (s Type) IsEmbedded(field string) bool {
+	for _, name := range s.Embedded {
+		if name == field {
+			return true
+		}
+	}
+	return false
 }
 
 func (s Type) String() string {
+	if s.Alias != nil {
+		return s.Alias.String()
+	}
 	fs := []string{}
 	for id, tn := range s.Fields {
-		fs = append(fs, fmt.Sprintf("%s %s", id, tn.String()))
+		if s.IsEmbedded(id) {
+			fs = append(fs, tn.String())
+		} else {
+			fs = append(fs, fmt.Sprintf("%s %s", id, tn.String()))
+		}
 	}
+	sort.Strings(fs)
 	vars := ""
 	if len(s.Vars) > 0 {
 		varNames := []string{}
@@ -48,6 +279,27 @@ func (s Type) String() string {
 	return fmt.Sprintf("struct%s{%s}", vars, fields)
 }
 
+// Params maps the type variables of a generic type to the concrete types it is instantiated with.
+func (s Type) Params(concrete []TypeName) map[string]TypeName {
+	params := make(map[string]TypeName)
+	for i, typeVar := range s.Vars {
+		if i < len(concrete) {
+			params[typeVar.Name] = concrete[i]
+		}
+	}
+	return params
+}
+
+// Instantiate returns a copy of s with its type variables replaced by concrete types.
+func (s Type) Instantiate(concrete []TypeName) (o Type) {
+	params := s.Params(concrete)
+	o = s.Copy()
+	for f, tn := range o.Fields {
+		o.Fields[f] = tn.Substitute(params)
+	}
+	return o
+}
+
 func (s Type) Copy() (o Type) {
 	o.Fields = make(map[string]TypeName)
 	o.Vars = make([]TypeName, len(s.Vars))
@@ -56,5 +308,74 @@ func (s Type) Copy() (o Type) {
 		o.Fields[f] = tn
 	}
 	copy(o.Vars, s.Vars)
+	o.Embedded = append(o.Embedded, s.Embedded...)
+	o.Alias = s.Alias
+	o.Methods = make(map[string]Method)
+	for name, method := range s.Methods {
+		o.Methods[name] = method
+	}
 	return o
 }
+
+// Resolve resolves the aliases in the field types of s, or in the type s is an alias of.
+// The type variables of s are left alone, even if there is a type with the same name.
+func (s Type) Resolve(lookup func(name string) *Type) Type {
+	vars := map[string]bool{}
+	for _, v := range s.Vars {
+		vars[v.Name] = true
+	}
+	outer := func(name string) *Type {
+		if vars[name] {
+			return nil
+		}
+		return lookup(name)
+	}
+	o := s.Copy()
+	for f, tn := range o.Fields {
+		o.Fields[f] = tn.Resolve(outer)
+	}
+	if o.Alias != nil {
+		alias := o.Alias.Resolve(outer)
+		o.Alias = &alias
+	}
+	return o
+}
+
+// Promote finds the field of an embedded struct that `s->field` refers to when s doesn't have field itself.
+// The embedded structs are searched breadth-first, so shallower fields hide deeper ones,
+// and it is ambiguous if there are several at the same depth.
+// path is the embedded fields to go through, ending with field, or nil if there is no such field.
+// lookup finds a type by name.
+func (s Type) Promote(field string, lookup func(name string) *Type) (path []string, ambiguous bool) {
+	type embedded struct {
+		ty   Type
+		path []string
+	}
+	level := []embedded{{ty: s}}
+	seen := map[string]bool{}
+	for len(level) > 0 {
+		found := [][]string{}
+		next := []embedded{}
+		for _, outer := range level {
+			for _, name := range outer.ty.Embedded {
+				tn := outer.ty.Fields[name]
+				template := lookup(tn.Name)
+				if template == nil || seen[tn.String()] {
+					// a type that embeds itself would never stop
+					continue
+				}
+				seen[tn.String()] = true
+				inner := embedded{ty: template.Instantiate(tn.Vars), path: append(append([]string{}, outer.path...), name)}
+				if _, ok := inner.ty.Fields[field]; ok {
+					found = append(found, append(inner.path, field))
+				}
+				next = append(next, inner)
+			}
+		}
+		if len(found) > 0 {
+			return found[0], len(found) > 1
+		}
+		level = next
+	}
+	return nil, false
+}
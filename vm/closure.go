@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/compile"
+	"github.com/bigyihsuan/structlang/util"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Closure is a compiled function together with the env it was defined in.
+// It prints and is typed like builtin.Func, the evaluator's function value.
+type Closure struct {
+	Func     *compile.Function
+	Env      *Env
+	TypeArgs []TypeName // the types filling in the type parameters of a generic function, once it is instantiated
+	IsReturn bool
+}
+
+// asFunc resolves the types of the function, as the evaluator does when it defines one.
+func (c Closure) asFunc() builtin.Func {
+	params := []TypeName{}
+	for _, arg := range c.Func.Args {
+		params = append(params, arg.Last)
+	}
+	signature := FuncType(params, c.Func.Ret)
+	signature.Params = c.Func.TypeParams
+	params, ret, _ := signature.Resolve(c.Env.GetType).FuncParts()
+
+	args := []util.Pair[string, TypeName]{}
+	for i, arg := range c.Func.Args {
+		args = append(args, util.Pair[string, TypeName]{First: arg.First, Last: params[i]})
+	}
+	fn := builtin.Func{TypeParams: c.Func.TypeParams, Args: args, Ret: ret}
+	if c.TypeArgs != nil {
+		// the type args were checked when the closure was instantiated
+		fn, _ = fn.Instantiate(c.TypeArgs)
+	}
+	return fn
+}
+
+func (c Closure) Get(field string) Value {
+	return c.asFunc().Get(field)
+}
+func (c Closure) TypeName() TypeName {
+	return c.asFunc().TypeName()
+}
+func (c Closure) Unwrap() any {
+	return c.asFunc().Unwrap()
+}
+func (c Closure) PrintString() string {
+	return c.asFunc().PrintString()
+}
+func (c Closure) Return(isReturn bool) Value {
+	c.IsReturn = isReturn
+	return c
+}
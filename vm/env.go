@@ -0,0 +1,53 @@
+package vm
+
+import (
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+// Env is a frame of variable slots, laid out by the compiler.
+// Types are still defined by name, since they are looked up by the struct literals that use them.
+type Env struct {
+	Parent *Env
+	Slots  []Value
+	Types  map[string]Type
+}
+
+func NewEnv(parent *Env, numSlots int) *Env {
+	return &Env{Parent: parent, Slots: make([]Value, numSlots)}
+}
+
+// Up returns the env depth levels above e.
+func (e *Env) Up(depth int) *Env {
+	for ; depth > 0; depth-- {
+		e = e.Parent
+	}
+	return e
+}
+
+func (e *Env) DefineType(typeName string, structType Type) {
+	if e.Types == nil {
+		e.Types = make(map[string]Type)
+	}
+	e.Types[typeName] = structType
+}
+
+// DefineMethod adds a method to the type typeName, in the env the type is defined in.
+// It reports false if there is no such type.
+func (e *Env) DefineMethod(typeName, name string, method Method) bool {
+	if t, ok := e.Types[typeName]; ok {
+		e.Types[typeName] = t.WithMethod(name, method)
+		return true
+	} else if e.Parent != nil {
+		return e.Parent.DefineMethod(typeName, name, method)
+	}
+	return false
+}
+func (e *Env) GetType(typeName string) *Type {
+	if t, ok := e.Types[typeName]; ok {
+		return &t
+	} else if e.Parent != nil {
+		return e.Parent.GetType(typeName)
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,402 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bigyihsuan/structlang/builtin"
+	"github.com/bigyihsuan/structlang/compile"
+	"github.com/bigyihsuan/structlang/diag"
+	"github.com/bigyihsuan/structlang/token"
+	"github.com/bigyihsuan/structlang/util"
+	. "github.com/bigyihsuan/structlang/value"
+)
+
+type frame struct {
+	fn  *compile.Function
+	pc  int
+	env *Env     // the innermost env, which changes when entering and leaving blocks
+	sp  int      // the stack height when the frame was entered
+	ret TypeName // the resolved return type of fn
+}
+
+// VM is a stack machine that runs a compiled Program
+// with the same observable behavior as eval.Evaluator.
+type VM struct {
+	Program *compile.Program
+	Globals *Env
+	stack   []Value
+	frames  []frame
+}
+
+func NewVM(prog *compile.Program) VM {
+	universe := NewEnv(nil, 0)
+	for name, ty := range builtin.Primitives {
+		universe.DefineType(name, ty.Copy())
+	}
+	return VM{
+		Program: prog,
+		Globals: NewEnv(universe, prog.Main.NumSlots),
+	}
+}
+
+// Run executes the program. Like the evaluator, a runtime error stops the top-level statement
+// it happened in, including the rest of any function or block it is in,
+// and the program goes on with the next top-level statement. All errors are returned together.
+func (m *VM) Run() error {
+	var errs error
+	m.frames = []frame{{fn: m.Program.Main, env: m.Globals}}
+	for {
+		err := m.run(0)
+		if err == nil {
+			return errs
+		}
+		errs = errors.Join(errs, m.errorAt(err))
+
+		// unwind to the top level and skip to the next statement
+		failed := m.frames[0].pc
+		m.frames = m.frames[:1]
+		m.frames[0].env = m.Globals
+		m.stack = m.stack[:0]
+		m.frames[0].pc = len(m.Program.Main.Code)
+		for _, start := range m.Program.Stmts {
+			if start >= failed {
+				m.frames[0].pc = start
+				break
+			}
+		}
+	}
+}
+
+// errorAt gives err the span of the instruction that failed in the innermost frame.
+func (m *VM) errorAt(err error) error {
+	f := m.frames[len(m.frames)-1]
+	if _, isDiag := err.(diag.Diagnostic); isDiag || f.pc == 0 || f.pc > len(f.fn.Spans) {
+		return err
+	}
+	d := diag.At(f.fn.Spans[f.pc-1], "%s", err)
+	d.Cause = err
+	return d
+}
+
+func (m *VM) push(v Value) {
+	m.stack = append(m.stack, v)
+}
+func (m *VM) pop() Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+func (m *VM) popN(n int) []Value {
+	vs := make([]Value, n)
+	copy(vs, m.stack[len(m.stack)-n:])
+	m.stack = m.stack[:len(m.stack)-n]
+	return vs
+}
+
+// run executes instructions until the frame stack shrinks to base frames.
+func (m *VM) run(base int) error {
+	prog := m.Program
+	for len(m.frames) > base {
+		f := &m.frames[len(m.frames)-1]
+		if f.pc >= len(f.fn.Code) {
+			// only the top level runs off the end, functions always return
+			m.frames = m.frames[:len(m.frames)-1]
+			continue
+		}
+		instr := f.fn.Code[f.pc]
+		f.pc++
+
+		switch instr.Op {
+		case compile.OpConst:
+			m.push(prog.Consts[instr.A])
+		case compile.OpPop:
+			m.pop()
+		case compile.OpLoad:
+			v := f.env.Up(instr.A).Slots[instr.B]
+			if v == nil {
+				return fmt.Errorf("variable `%s` not defined", prog.Names[instr.C])
+			}
+			m.push(v)
+		case compile.OpDefine:
+			f.env.Slots[instr.A] = Copy(m.pop())
+		case compile.OpStore:
+			env := f.env.Up(instr.A)
+			variable := env.Slots[instr.B]
+			if variable == nil {
+				return fmt.Errorf("variable `%s` not defined", prog.Names[instr.C])
+			}
+			value := m.pop()
+			if coerced, ok := builtin.Coerce(value, variable.TypeName()); ok {
+				value = coerced
+			} else {
+				return fmt.Errorf("mismatched types: want to set `%s`, got `%s`", variable.TypeName(), value.TypeName())
+			}
+			env.Slots[instr.B] = Copy(value)
+		case compile.OpField:
+			base := m.pop()
+			field := base.Get(prog.Names[instr.A])
+			if field == nil {
+				return fmt.Errorf("field `%s` not found in type `%s`", prog.Names[instr.A], base.TypeName())
+			}
+			m.push(field)
+		case compile.OpSetField:
+			base := m.pop()
+			if err := builtin.SetField(base, prog.Names[instr.A], m.pop()); err != nil {
+				return err
+			}
+		case compile.OpIndex:
+			index := m.pop()
+			v, err := builtin.Index(m.pop(), index)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpSetIndex:
+			index := m.pop()
+			base := m.pop()
+			if err := builtin.SetIndex(base, index, m.pop()); err != nil {
+				return err
+			}
+		case compile.OpPrefix:
+			v, err := builtin.Prefix(token.TokenType(instr.A), m.pop())
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpInfix:
+			right := m.pop()
+			left := m.pop()
+			v, err := builtin.Infix(token.TokenType(instr.A), left, right)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpIs:
+			_, holds := builtin.Narrow(m.pop(), prog.Types[instr.A].Resolve(f.env.GetType))
+			m.push(builtin.NewBool(holds))
+		case compile.OpStruct:
+			literal := prog.Literals[instr.A]
+			values := m.popN(len(literal.Fields))
+			typename := literal.Type.Resolve(f.env.GetType)
+			st := f.env.GetType(typename.Name)
+			if st == nil {
+				return fmt.Errorf("type not found: %s", typename.Name)
+			}
+			fields := []util.Pair[string, Value]{}
+			for i, name := range literal.Fields {
+				fields = append(fields, util.Pair[string, Value]{First: name, Last: values[i]})
+			}
+			v, err := builtin.NewStructLiteral(*st, typename, fields, f.env.GetType)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpList:
+			elems := m.popN(instr.A)
+			ty := prog.Types[instr.B].Resolve(f.env.GetType)
+			if !ty.IsList() {
+				return fmt.Errorf("cannot build `%s` with a list literal", ty)
+			}
+			v, err := builtin.NewList(ty.Vars[0], elems)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpMap:
+			entries := m.popN(2 * instr.A)
+			ty := prog.Types[instr.B].Resolve(f.env.GetType)
+			if !ty.IsMap() {
+				return fmt.Errorf("cannot build `%s` with a map literal", ty)
+			}
+			keys, vals := []Value{}, []Value{}
+			for i := 0; i < len(entries); i += 2 {
+				keys, vals = append(keys, entries[i]), append(vals, entries[i+1])
+			}
+			v, err := builtin.NewMap(ty.Vars[0], ty.Vars[1], keys, vals)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpTypeDef:
+			td := prog.TypeDefs[instr.A]
+			if builtin.IsBuiltin(td.Name) {
+				return fmt.Errorf("cannot redefine builtin type `%s`", td.Name)
+			}
+			// aliases are resolved now, so that they mean what they did where the type was defined
+			f.env.DefineType(td.Name, td.Type.Resolve(f.env.GetType))
+		case compile.OpClosure:
+			m.push(Closure{Func: prog.Functions[instr.A], Env: f.env})
+		case compile.OpCallMethod:
+			receiver := m.pop()
+			args := m.popN(instr.A)
+			name := prog.Names[instr.B]
+			fn, isMethod := builtin.MethodOf(receiver, name, f.env.GetType)
+			if isMethod {
+				args = append([]Value{receiver}, args...)
+			} else if native, isNative := builtin.NativeMethod(receiver, name); isNative {
+				v, err := native(args...)
+				if err != nil {
+					return err
+				}
+				m.push(v)
+				continue
+			} else if fn = receiver.Get(name); fn == nil {
+				return fmt.Errorf("field `%s` not found in type `%s`", name, receiver.TypeName())
+			}
+			if err := m.call(fn, args); err != nil {
+				return err
+			}
+		case compile.OpMethod:
+			fn := m.pop()
+			typeName := prog.Names[instr.A]
+			if err := builtin.ReceiverError(typeName, f.env.GetType); err != nil {
+				return err
+			}
+			f.env.DefineMethod(typeName, prog.Names[instr.B], Method{Type: fn.TypeName(), Value: fn})
+		case compile.OpInstantiate:
+			fn := m.pop()
+			closure, isClosure := fn.(Closure)
+			if !isClosure {
+				return fmt.Errorf("cannot call non-function of type `%s`", fn.TypeName())
+			}
+			typeArgs := []TypeName{}
+			for _, typeArg := range prog.Types[instr.A : instr.A+instr.B] {
+				typeArgs = append(typeArgs, typeArg.Resolve(f.env.GetType))
+			}
+			if _, err := closure.asFunc().Instantiate(typeArgs); err != nil {
+				return err
+			}
+			closure.TypeArgs = typeArgs
+			m.push(closure)
+		case compile.OpCall:
+			fn := m.pop()
+			args := m.popN(instr.A)
+			if err := m.call(fn, args); err != nil {
+				return err
+			}
+		case compile.OpCallBuiltin:
+			args := m.popN(instr.B)
+			v, err := builtin.BuiltinFuncs()[prog.Names[instr.A]].Call(args...)
+			if err != nil {
+				return err
+			}
+			m.push(v)
+		case compile.OpReturn:
+			v := m.pop()
+			if len(m.frames) > 1 {
+				checked, err := builtin.CheckReturn(v, f.ret, instr.A == 1)
+				if err != nil {
+					// reported at the call, like the evaluator does
+					m.frames = m.frames[:len(m.frames)-1]
+					return err
+				}
+				v = checked
+			}
+			m.stack = m.stack[:f.sp]
+			m.frames = m.frames[:len(m.frames)-1]
+			m.push(v)
+		case compile.OpJump:
+			f.pc = instr.A
+		case compile.OpJumpIfFalse:
+			v := m.pop()
+			cond, isBool := v.(builtin.BoolValue)
+			if !isBool {
+				return fmt.Errorf("condition must be `bool`, got `%s`", v.TypeName())
+			}
+			if !cond.Unwrap().(bool) {
+				f.pc = instr.A
+			}
+		case compile.OpEnterBlock:
+			f.env = NewEnv(f.env, instr.A)
+		case compile.OpLeaveBlock:
+			f.env = f.env.Parent
+		case compile.OpMatchArm:
+			if held, matches := builtin.Narrow(m.stack[len(m.stack)-1], prog.Types[instr.A].Resolve(f.env.GetType)); matches {
+				m.stack[len(m.stack)-1] = held
+			} else {
+				f.pc = instr.B
+			}
+		case compile.OpNoMatch:
+			return fmt.Errorf("no match arm for value of type `%s`", m.pop().TypeName())
+		case compile.OpFail:
+			return errors.New(prog.Names[instr.A])
+		case compile.OpIter:
+			it, err := builtin.Iterate(m.pop(), instr.A == 1, f.env.GetType, m.callNow)
+			if err != nil {
+				return err
+			}
+			m.push(it)
+		case compile.OpRange:
+			end := m.pop()
+			it, err := builtin.Range(m.pop(), end)
+			if err != nil {
+				return err
+			}
+			m.push(it)
+		case compile.OpNext:
+			index, elem, ok, err := m.stack[len(m.stack)-1].(builtin.Iterator).Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// going through a struct runs functions, which can move the frames
+				m.frames[len(m.frames)-1].pc = instr.A
+				continue
+			}
+			m.push(index)
+			m.push(elem)
+		default:
+			return fmt.Errorf("vm unknown instruction: %s", instr)
+		}
+	}
+	return nil
+}
+
+// callNow calls fn and runs it to its return, for the builtins that call functions.
+func (m *VM) callNow(fn Value, args []Value) (Value, error) {
+	base := len(m.frames)
+	if err := m.call(fn, args); err != nil {
+		return nil, err
+	}
+	if err := m.run(base); err != nil {
+		return nil, err
+	}
+	return m.pop(), nil
+}
+
+// call enters a closure: its arguments are bound in a fresh env whose parent is the env it was defined in.
+func (m *VM) call(fn Value, args []Value) error {
+	closure, isClosure := fn.(Closure)
+	if !isClosure {
+		return fmt.Errorf("cannot call non-function of type `%s`", fn.TypeName())
+	}
+	if len(args) != len(closure.Func.Args) {
+		return fmt.Errorf("incorrect numbers of arguments for func: got %d, want %d", len(args), len(closure.Func.Args))
+	}
+	if len(m.frames) > builtin.MaxCallDepth { // the first frame is the program itself
+		return builtin.ErrCallDepth
+	}
+	f := closure.asFunc()
+	if f.IsGeneric() {
+		typeArgs, err := f.Infer(args)
+		if err != nil {
+			return err
+		}
+		if f, err = f.Instantiate(typeArgs); err != nil {
+			return err
+		}
+	}
+	env := NewEnv(closure.Env, closure.Func.NumSlots)
+	f.DefineTypeArgs(env.DefineType)
+	for i, arg := range args {
+		argType := f.Args[i].Last
+		coerced, ok := builtin.Coerce(arg, argType)
+		if !ok {
+			return fmt.Errorf("incorrect argument types for func: got %s, want %s", arg.TypeName(), argType)
+		}
+		env.Slots[i] = Copy(coerced)
+	}
+	m.frames = append(m.frames, frame{fn: closure.Func, env: env, sp: len(m.stack), ret: f.Ret})
+	return nil
+}